@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The annotations are shown after the names, between brackets, in a
+// trailing comment. eg. "scan_001.png<TAB>// [1.2 MB | 2015-06-01 12:00 | 2480x3508]"
+const (
+	ANNOTATION_START     = " ["
+	ANNOTATION_END       = "]"
+	ANNOTATION_SEPARATOR = " | "
+)
+
+const ANNOTATION_TIME_FORMAT = "2006-01-02 15:04"
+
+// Returns the annotation of the file, or an empty string if it cannot be
+// extracted (eg. the dimensions of a text file).
+type annotationExtractor func(path string, info os.FileInfo) string
+
+var annotationExtractors_ = map[string]annotationExtractor{
+	"size":       sizeAnnotation,
+	"mtime":      mtimeAnnotation,
+	"dimensions": dimensionsAnnotation,
+	"duration":   durationAnnotation,
+}
+
+// Makes a new annotation available to the "annotations" config value.
+func registerAnnotationExtractor(name string, extractor annotationExtractor) {
+	annotationExtractors_[name] = extractor
+}
+
+// Parses a comma-separated list of annotation names. eg. "size,mtime"
+func parseAnnotations(spec string) ([]string, error) {
+	var output []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := annotationExtractors_[name]; !ok {
+			var names []string
+			for n := range annotationExtractors_ {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return []string{}, errors.New(fmt.Sprintf("unknown annotation: \"%s\". Possible values: %s", name, strings.Join(names, ", ")))
+		}
+		output = append(output, name)
+	}
+	return output, nil
+}
+
+func annotationSeparator(commentMarker string) string {
+	return "\t" + commentMarker + ANNOTATION_START
+}
+
+// Returns the trailing comment with the annotations of the file, or an
+// empty string if none of them could be extracted.
+func annotationComment(path string, annotations []string, commentMarker string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	var values []string
+	for _, name := range annotations {
+		if value := annotationExtractors_[name](path, info); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return ""
+	}
+	return annotationSeparator(commentMarker) + strings.Join(values, ANNOTATION_SEPARATOR) + ANNOTATION_END
+}
+
+// Removes the annotation comment added by annotationComment(), whatever
+// has been written in it.
+func stripAnnotationComment(line string, commentMarker string) string {
+	index := strings.LastIndex(line, annotationSeparator(commentMarker))
+	if index < 0 {
+		return line
+	}
+	return line[:index]
+}
+
+func formatFileSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+func formatDuration(duration time.Duration) string {
+	seconds := int64(duration.Seconds() + 0.5)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, (seconds/60)%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func sizeAnnotation(path string, info os.FileInfo) string {
+	if info.IsDir() {
+		return ""
+	}
+	return formatFileSize(info.Size())
+}
+
+func mtimeAnnotation(path string, info os.FileInfo) string {
+	return info.ModTime().Format(ANNOTATION_TIME_FORMAT)
+}
+
+// Supports the image formats registered with the image package: JPEG, PNG
+// and GIF.
+func dimensionsAnnotation(path string, info os.FileInfo) string {
+	if info.IsDir() {
+		return ""
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", config.Width, config.Height)
+}
+
+// Extensions of the files whose duration is read with ffprobe, if it is
+// installed.
+var mediaExtensions = []string{".mp3", ".m4a", ".aac", ".ogg", ".opus", ".flac", ".mp4", ".m4v", ".mkv", ".mov", ".avi", ".webm", ".wmv"}
+
+// The duration of WAV files is read directly, the one of the other audio
+// and video files with ffprobe.
+func durationAnnotation(path string, info os.FileInfo) string {
+	if info.IsDir() {
+		return ""
+	}
+
+	ext := strings.ToLower(fileExtension(info.Name()))
+	if ext == ".wav" {
+		duration, err := wavDuration(path)
+		if err != nil {
+			return ""
+		}
+		return formatDuration(duration)
+	}
+
+	for _, mediaExt := range mediaExtensions {
+		if ext == mediaExt {
+			duration, err := ffprobeDuration(path)
+			if err != nil {
+				return ""
+			}
+			return formatDuration(duration)
+		}
+	}
+
+	return ""
+}
+
+// Reads the duration from the "fmt " and "data" chunks of a RIFF WAVE
+// file.
+func wavDuration(path string) (time.Duration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return 0, errors.New("not a WAVE file")
+	}
+
+	var byteRate uint32
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, chunkHeader); err != nil {
+			return 0, err
+		}
+		chunkSize := binary.LittleEndian.Uint32(chunkHeader[4:8])
+
+		switch string(chunkHeader[0:4]) {
+		case "fmt ":
+			if chunkSize < 12 || chunkSize > 1024 {
+				return 0, errors.New("invalid fmt chunk")
+			}
+			format := make([]byte, chunkSize)
+			if _, err := io.ReadFull(file, format); err != nil {
+				return 0, err
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("missing fmt chunk")
+			}
+			return time.Duration(float64(chunkSize) / float64(byteRate) * float64(time.Second)), nil
+		default:
+			if _, err := file.Seek(int64(chunkSize), io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		}
+
+		// Chunks are aligned on two bytes
+		if chunkSize%2 == 1 {
+			if _, err := file.Seek(1, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+func ffprobeDuration(path string) (time.Duration, error) {
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := exec.Command(ffprobe, "-v", "error", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_parseAnnotations(t *testing.T) {
+	annotations, err := parseAnnotations(" Size, mtime,,dimensions ")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(annotations) != 3 || annotations[0] != "size" || annotations[2] != "dimensions" {
+		t.Errorf("Incorrect annotations: %v", annotations)
+	}
+
+	_, err = parseAnnotations("size,colour")
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
+
+func Test_formatFileSize(t *testing.T) {
+	testCases := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KB",
+		5 * 1024 * 1024: "5.0 MB",
+		3 << 40:         "3.0 TB",
+	}
+
+	for size, expected := range testCases {
+		if actual := formatFileSize(size); actual != expected {
+			t.Errorf("%d: expected \"%s\", got \"%s\"", size, expected, actual)
+		}
+	}
+}
+
+func Test_annotations(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	imagePath := filepath.Join(tempFolder(), "scan.png")
+	file, _ := os.Create(imagePath)
+	png.Encode(file, image.NewGray(image.Rect(0, 0, 40, 30)))
+	file.Close()
+
+	// 2 seconds of 8 kHz, 8-bit mono audio
+	wav := []byte("RIFF\x00\x00\x00\x00WAVEfmt ")
+	format := make([]byte, 20)
+	binary.LittleEndian.PutUint32(format[0:4], 16)
+	binary.LittleEndian.PutUint16(format[4:6], 1)
+	binary.LittleEndian.PutUint16(format[6:8], 1)
+	binary.LittleEndian.PutUint32(format[8:12], 8000)
+	binary.LittleEndian.PutUint32(format[12:16], 8000)
+	wav = append(wav, format...)
+	wav = append(wav, []byte("data\x80\x3e\x00\x00")...)
+	wav = append(wav, make([]byte, 16000)...)
+	wavPath := filepath.Join(tempFolder(), "voice.wav")
+	ioutil.WriteFile(wavPath, wav, 0644)
+
+	textPath := filepath.Join(tempFolder(), "notes.txt")
+	ioutil.WriteFile(textPath, []byte("hello"), 0644)
+
+	mtime := time.Date(2015, 6, 1, 12, 30, 0, 0, time.Local)
+	os.Chtimes(textPath, mtime, mtime)
+
+	paths := []string{imagePath, wavPath, textPath}
+	content := createListFileContentWithOptions(paths, ListFileOptions{Annotations: []string{"dimensions", "duration", "size"}})
+	expected := "scan.png\t// [40x30 | " + formatFileSize(fileSize(imagePath)) + "]\nvoice.wav\t// [0:02 | 15.7 KB]\nnotes.txt\t// [5 B]\n"
+	if content != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, content)
+	}
+
+	// Custom extractor
+	registerAnnotationExtractor("first-letter", func(path string, info os.FileInfo) string {
+		return info.Name()[0:1]
+	})
+	defer delete(annotationExtractors_, "first-letter")
+
+	annotations, err := parseAnnotations("mtime,first-letter")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	content = createListFileContentWithOptions(paths[2:], ListFileOptions{Annotations: annotations, LockExtensions: true})
+	if content != "notes\t// .txt\t// [2015-06-01 12:30 | n]\n" {
+		t.Errorf("Unexpected content: \"%s\"", content)
+	}
+
+	// The annotations are ignored, even if they have been changed
+	content = "scan.png\t// [40x30]\nsound.wav\t// [changed]\n//notes.txt\t// [5 B]\n"
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{Annotations: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(actions) != 2 || actions[0].newPath != "sound.wav" || actions[1].kind != KIND_DELETE {
+		t.Errorf("Unexpected actions: %v", actions)
+	}
+
+	content = "notes.txt => new\t// .txt\t// [5 B]\n"
+	actions, err = fileActionsWithOptions(paths[2:], content, FileActionOptions{Annotations: true, LockExtensions: true, TwoColumns: true})
+	if err != nil || len(actions) != 1 || actions[0].newPath != "new.txt" {
+		t.Errorf("Expected \"new.txt\", got %v, %v", actions, err)
+	}
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
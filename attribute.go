@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The attributes are shown after the names in a trailing comment, and the
+// file attributes are changed when they are edited. eg.
+// "scan_001.png<TAB>// {mtime: 2015-06-01 12:00:05, mode: 0644}"
+const (
+	ATTRIBUTE_START     = " {"
+	ATTRIBUTE_END       = "}"
+	ATTRIBUTE_SEPARATOR = ", "
+)
+
+const (
+	ATTRIBUTE_MTIME = "mtime"
+	ATTRIBUTE_MODE  = "mode"
+)
+
+const ATTRIBUTE_TIME_FORMAT = "2006-01-02 15:04:05"
+
+// Layouts accepted when the modification time is edited.
+var attributeTimeLayouts = []string{
+	ATTRIBUTE_TIME_FORMAT,
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC3339Nano,
+}
+
+// Parses a comma-separated list of attribute names. eg. "mtime,mode"
+func parseAttributes(spec string) ([]string, error) {
+	var output []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name != ATTRIBUTE_MTIME && name != ATTRIBUTE_MODE {
+			return []string{}, errors.New(fmt.Sprintf("unknown attribute: \"%s\". Possible values: %s, %s", name, ATTRIBUTE_MTIME, ATTRIBUTE_MODE))
+		}
+		output = append(output, name)
+	}
+	return output, nil
+}
+
+func attributeSeparator(commentMarker string) string {
+	return "\t" + commentMarker + ATTRIBUTE_START
+}
+
+func formatMtime(mtime time.Time) string {
+	return mtime.Local().Format(ATTRIBUTE_TIME_FORMAT)
+}
+
+// Bits of the mode that are shown and changed: the permissions, and the
+// setuid, setgid and sticky bits, which os.Chmod would otherwise clear.
+const ATTRIBUTE_MODE_MASK = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// Returns the mode in octal, with the setuid, setgid and sticky bits as the
+// first digit. eg. "4755"
+func formatMode(mode os.FileMode) string {
+	output := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		output |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		output |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		output |= 01000
+	}
+	return fmt.Sprintf("%04o", output)
+}
+
+// Returns the trailing comment with the attributes of the file, or an empty
+// string if the file cannot be read.
+func attributeComment(path string, attributes []string, commentMarker string) string {
+	info, err := os.Stat(path)
+	if err != nil || len(attributes) == 0 {
+		return ""
+	}
+
+	var values []string
+	for _, name := range attributes {
+		switch name {
+		case ATTRIBUTE_MTIME:
+			values = append(values, ATTRIBUTE_MTIME+": "+formatMtime(info.ModTime()))
+		case ATTRIBUTE_MODE:
+			values = append(values, ATTRIBUTE_MODE+": "+formatMode(info.Mode()))
+		}
+	}
+	return attributeSeparator(commentMarker) + strings.Join(values, ATTRIBUTE_SEPARATOR) + ATTRIBUTE_END
+}
+
+// Removes the attribute comment from the line, and returns the attribute
+// values it contains. The attributes that have been removed from the
+// comment are left as they are.
+func parseAttributeComment(line string, commentMarker string) (string, map[string]string, error) {
+	values := make(map[string]string)
+
+	index := strings.LastIndex(line, attributeSeparator(commentMarker))
+	if index < 0 {
+		return line, values, nil
+	}
+
+	comment := strings.Trim(line[index+len(attributeSeparator(commentMarker)):], " \t")
+	comment = strings.TrimSuffix(comment, ATTRIBUTE_END)
+
+	for _, field := range strings.Split(comment, ",") {
+		field = strings.Trim(field, " \t")
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, ":", 2)
+		name := strings.ToLower(strings.Trim(parts[0], " \t"))
+		if len(parts) != 2 || (name != ATTRIBUTE_MTIME && name != ATTRIBUTE_MODE) {
+			return line, values, errors.New(fmt.Sprintf("invalid attribute: \"%s\". Expected \"%s: <date>\" or \"%s: <octal mode>\"", field, ATTRIBUTE_MTIME, ATTRIBUTE_MODE))
+		}
+		values[name] = strings.Trim(parts[1], " \t")
+	}
+
+	return line[:index], values, nil
+}
+
+func parseMtime(s string) (time.Time, error) {
+	for _, layout := range attributeTimeLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("invalid mtime: \"%s\". Expected a date such as \"%s\"", s, ATTRIBUTE_TIME_FORMAT))
+}
+
+func parseMode(s string) (os.FileMode, error) {
+	value, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || value > 07777 {
+		return 0, errors.New(fmt.Sprintf("invalid mode: \"%s\". Expected an octal value between 0000 and 7777", s))
+	}
+
+	mode := os.FileMode(value & 0777)
+	if value&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if value&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if value&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// Returns the touch and chmod actions for the attributes that are different
+// from the ones of the file. The actions apply to the file wherever it is
+// once the renames have been done.
+func attributeFileActions(path string, values map[string]string, line int) ([]*FileAction, error) {
+	var output []*FileAction
+	if len(values) == 0 {
+		return output, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return output, errors.New(fmt.Sprintf("line %d: cannot stat \"%s\"", line, path))
+	}
+
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := values[name]
+		action := NewFileAction()
+		action.oldPath = path
+		action.newPath = filepath.Base(path)
+		action.line = line
+
+		switch name {
+		case ATTRIBUTE_MTIME:
+			if value == formatMtime(info.ModTime()) {
+				continue
+			}
+			mtime, err := parseMtime(value)
+			if err != nil {
+				return []*FileAction{}, errors.New(fmt.Sprintf("line %d: %s", line, err))
+			}
+			action.kind = KIND_TOUCH
+			action.mtime = mtime
+		case ATTRIBUTE_MODE:
+			mode, err := parseMode(value)
+			if err != nil {
+				return []*FileAction{}, errors.New(fmt.Sprintf("line %d: %s", line, err))
+			}
+			if mode == info.Mode()&ATTRIBUTE_MODE_MASK {
+				continue
+			}
+			action.kind = KIND_CHMOD
+			action.mode = mode
+		}
+
+		output = append(output, action)
+	}
+
+	return output, nil
+}
+
+// Returns eg. "mtime 2015-06-01 12:00:05" or "mode 0644".
+func attributeActionValue(action *FileAction) string {
+	if action.kind == KIND_TOUCH {
+		return ATTRIBUTE_MTIME + " " + formatMtime(action.mtime)
+	}
+	return ATTRIBUTE_MODE + " " + formatMode(action.mode)
+}
+
+func isAttributeAction(action *FileAction) bool {
+	return action.kind == KIND_TOUCH || action.kind == KIND_CHMOD
+}
+
+// Changes the attribute of the file, which is first looked up among the
+// renames that have been done. The previous value is recorded in the action
+// so that it can be undone.
+func processAttributeAction(action *FileAction, doneActions []*FileAction, dryRun bool) error {
+	path, ok := pathAfterActions(action.FullOldPath(), doneActions)
+	if !ok {
+		return nil
+	}
+	action.oldPath = path
+	action.newPath = filepath.Base(path)
+
+	if dryRun {
+		logInfo("\"%s\"  =>  %s", path, attributeActionValue(action))
+		return nil
+	}
+
+	logDebug("\"%s\"  =>  %s", path, attributeActionValue(action))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if action.kind == KIND_TOUCH {
+		action.previousMtime = info.ModTime()
+		// The access time is left unchanged
+		return os.Chtimes(path, time.Time{}, action.mtime)
+	}
+
+	action.previousMode = info.Mode() & ATTRIBUTE_MODE_MASK
+	return os.Chmod(path, action.mode)
+}
+
+// Restores the attribute changed by a touch or chmod operation.
+func undoAttributeHistoryItem(item HistoryItem) error {
+	if item.Kind == KIND_TOUCH {
+		mtime, err := time.Parse(time.RFC3339Nano, item.PreviousValue)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid previous mtime of \"%s\": \"%s\"", item.Dest, item.PreviousValue))
+		}
+		return os.Chtimes(item.Dest, time.Time{}, mtime)
+	}
+
+	mode, err := parseMode(item.PreviousValue)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid previous mode of \"%s\": \"%s\"", item.Dest, item.PreviousValue))
+	}
+	return os.Chmod(item.Dest, mode)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func Test_parseAttributeComment(t *testing.T) {
+	line, values, err := parseAttributeComment("beach\t// .jpg\t// {mtime: 2015-06-01 12:00:05, mode: 0644}", "//")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if line != "beach\t// .jpg" || values["mtime"] != "2015-06-01 12:00:05" || values["mode"] != "0644" {
+		t.Errorf("Incorrect result: \"%s\", %v", line, values)
+	}
+
+	line, values, err = parseAttributeComment("beach.jpg\t// {mode: 755", "//")
+	if err != nil || line != "beach.jpg" || len(values) != 1 || values["mode"] != "755" {
+		t.Errorf("Incorrect result: \"%s\", %v, %v", line, values, err)
+	}
+
+	_, _, err = parseAttributeComment("beach.jpg\t// {owner: root}", "//")
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+
+	for _, mode := range []string{"0644", "4755", "2775", "1777"} {
+		parsed, err := parseMode(mode)
+		if err != nil || formatMode(parsed) != mode {
+			t.Errorf("\"%s\": expected the same mode, got \"%s\", %v", mode, formatMode(parsed), err)
+		}
+	}
+
+	for _, mode := range []string{"0955", "17777", "rw-r--r--", ""} {
+		if _, err := parseMode(mode); err == nil {
+			t.Errorf("\"%s\": expected an error, got nil", mode)
+		}
+	}
+
+	for _, mtime := range []string{"2015-06-01", "2015-06-01 12:00", "2015-06-01T12:00:05.123+02:00"} {
+		if _, err := parseMtime(mtime); err != nil {
+			t.Errorf("\"%s\": expected no error, got %s", mtime, err)
+		}
+	}
+}
+
+func Test_attributeFileActions(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	one := filepath.Join(tempFolder(), "one")
+	two := filepath.Join(tempFolder(), "two")
+	touch(one)
+	touch(two)
+	os.Chmod(one, 0644)
+	os.Chmod(two, 0644)
+
+	mtime := time.Date(2015, 6, 1, 12, 0, 5, 0, time.Local)
+	os.Chtimes(one, mtime, mtime)
+	os.Chtimes(two, mtime, mtime)
+
+	paths := []string{one, two}
+	content := createListFileContentWithOptions(paths, ListFileOptions{Attributes: []string{"mtime", "mode"}})
+	expected := "one\t// {mtime: 2015-06-01 12:00:05, mode: 0644}\ntwo\t// {mtime: 2015-06-01 12:00:05, mode: 0644}\n"
+	if content != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, content)
+	}
+
+	options := FileActionOptions{Attributes: true}
+
+	// Unchanged buffer
+	actions, err := fileActionsWithOptions(paths, content, options)
+	if err != nil || len(actions) != 0 {
+		t.Fatalf("Expected no action, got %v, %v", actions, err)
+	}
+
+	invalidContents := []string{
+		"one\t// {mtime: yesterday}\ntwo\n",
+		"one\t// {mode: 0999}\ntwo\n",
+	}
+	for _, invalidContent := range invalidContents {
+		if _, err := fileActionsWithOptions(paths, invalidContent, options); err == nil {
+			t.Errorf("\"%s\": expected an error, got nil", invalidContent)
+		}
+	}
+
+	// "one" is renamed and touched, and the mode of "two" is changed
+	content = "1\t// {mtime: 2020-01-02 03:04:05, mode: 0644}\ntwo\t// {mode: 0600}\n"
+	actions, err = fileActionsWithOptions(paths, content, options)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(actions) != 3 || actions[0].kind != KIND_RENAME || actions[1].kind != KIND_TOUCH || actions[2].kind != KIND_CHMOD {
+		t.Fatalf("Unexpected actions: %v", actions)
+	}
+
+	err = processFileActions(actions, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	info, err := os.Stat(filepath.Join(tempFolder(), "1"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !info.ModTime().Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)) {
+		t.Errorf("Incorrect mtime: %s", info.ModTime())
+	}
+
+	info, _ = os.Stat(two)
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Incorrect mode: %o", info.Mode().Perm())
+	}
+
+	items, _ := allHistoryItems()
+	if len(items) != 3 || items[1].Kind != KIND_TOUCH || items[1].Dest != normalizePath(filepath.Join(tempFolder(), "1")) || items[2].PreviousValue != "0644" {
+		t.Fatalf("Unexpected history items: %v", items)
+	}
+
+	// Undoing the operation restores the name and the attributes
+	var opts CommandLineOptions
+	err = handleUndoCommand(&opts, []string{filepath.Join(tempFolder(), "1"), two})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	info, err = os.Stat(one)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Incorrect mtime: %s", info.ModTime())
+	}
+
+	info, _ = os.Stat(two)
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0644 {
+		t.Errorf("Incorrect mode: %o", info.Mode().Perm())
+	}
+
+	items, _ = allHistoryItems()
+	if len(items) != 0 {
+		t.Errorf("Expected no history item, got %d", len(items))
+	}
+}
+
+func Test_attributeFileActions_dryRun(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	one := filepath.Join(tempFolder(), "one")
+	touch(one)
+	os.Chmod(one, 0644)
+
+	actions, err := fileActionsWithOptions([]string{one}, "one => 1\t// {mode: 0600}\n", FileActionOptions{Attributes: true, TwoColumns: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = processFileActions(actions, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	info, _ := os.Stat(one)
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0644 {
+		t.Errorf("The mode has been changed in dry run mode")
+	}
+
+	// The action applies to the file once renamed
+	for _, action := range actions {
+		if action.kind == KIND_CHMOD && action.FullOldPath() != normalizePath(filepath.Join(tempFolder(), "1")) {
+			t.Errorf("Unexpected path: %s", action.FullOldPath())
+		}
+	}
+}
+
+func Test_attributeFileActions_specialModeBits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The setuid bit is not supported on Windows")
+	}
+
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	one := filepath.Join(tempFolder(), "one")
+	touch(one)
+	os.Chmod(one, 0755|os.ModeSetuid)
+
+	content := createListFileContentWithOptions([]string{one}, ListFileOptions{Attributes: []string{"mode"}})
+	if content != "one\t// {mode: 4755}\n" {
+		t.Fatalf("Unexpected content: \"%s\"", content)
+	}
+
+	actions, err := fileActionsWithOptions([]string{one}, "one\t// {mode: 4700}\n", FileActionOptions{Attributes: true})
+	if err != nil || len(actions) != 1 {
+		t.Fatalf("Expected one action, got %v, %v", actions, err)
+	}
+
+	err = processFileActions(actions, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	info, _ := os.Stat(one)
+	if info.Mode()&ATTRIBUTE_MODE_MASK != 0700|os.ModeSetuid {
+		t.Errorf("Incorrect mode: %s", info.Mode())
+	}
+
+	var opts CommandLineOptions
+	err = handleUndoCommand(&opts, []string{one})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	info, _ = os.Stat(one)
+	if info.Mode()&ATTRIBUTE_MODE_MASK != 0755|os.ModeSetuid {
+		t.Errorf("Incorrect mode after undo: %s", info.Mode())
+	}
+}
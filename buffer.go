@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kr/text"
+)
+
+const DEFAULT_COMMENT_MARKER = "//"
+
+// The header template can contain these placeholders:
+//
+//   - {count}: the number of files in the buffer
+//   - {directory}: the directory that contains all the files
+//   - {hints}: the default explanation of how to edit the buffer
+//   - {comment} and {delete}: the comment and delete markers
+//   - {appname}: the name of the application
+//
+// "\n" starts a new line. The lines are wrapped, except the ones that
+// contain {hints}, which is already wrapped.
+const DEFAULT_HEADER_TEMPLATE = "{hints}"
+
+// Markers used in the file buffer. A line that starts with the delete
+// marker followed by the name of the file deletes the file. Any other line
+// that starts with the comment marker is ignored, unless it is the
+// unchanged name of a file that starts with the marker.
+type BufferMarkers struct {
+	Comment string // Empty for DEFAULT_COMMENT_MARKER
+	Delete  string // Empty for the same marker as the comment one
+}
+
+func (this BufferMarkers) commentMarker() string {
+	if this.Comment == "" {
+		return DEFAULT_COMMENT_MARKER
+	}
+	return this.Comment
+}
+
+func (this BufferMarkers) deleteMarker() string {
+	if this.Delete == "" {
+		return this.commentMarker()
+	}
+	return this.Delete
+}
+
+func (this BufferMarkers) validate() error {
+	for _, marker := range []string{this.Comment, this.Delete} {
+		if marker != "" && strings.TrimSpace(marker) == "" {
+			return errors.New(fmt.Sprintf("invalid buffer marker: \"%s\": a marker cannot be made of spaces only", marker))
+		}
+	}
+	return nil
+}
+
+func (this BufferMarkers) isComment(line string) bool {
+	return strings.HasPrefix(line, this.commentMarker())
+}
+
+// Returns the name that follows the delete marker, if the line starts with
+// it. The name might not be one of the files, in which case the line is a
+// comment or a new name.
+func (this BufferMarkers) deletedName(line string) (string, bool) {
+	if !strings.HasPrefix(line, this.deleteMarker()) {
+		return "", false
+	}
+	return strings.Trim(line[len(this.deleteMarker()):], " \t"), true
+}
+
+func (this BufferMarkers) deleteLine(name string) string {
+	return this.deleteMarker() + name
+}
+
+// Returns the number of lines of the header, which is made of comment lines
+// followed by an empty line, or 0 if the lines don't start with a header. The
+// header lines are always comments, even if one of them is the name of a file
+// that starts with the comment marker. The last line is ignored since it is
+// empty when the buffer ends with a newline.
+func (this BufferMarkers) headerLength(lines []string) int {
+	for i, line := range lines[:len(lines)-1] {
+		if line == "" {
+			return i
+		}
+		if !this.isComment(line) {
+			return 0
+		}
+	}
+	return 0
+}
+
+// Returns the directory that contains all the files.
+func commonDirectory(filePaths []string) string {
+	output := ""
+	for _, filePath := range filePaths {
+		dir := filepath.Dir(normalizePath(filePath))
+		if output == "" {
+			output = dir
+			continue
+		}
+		for output != dir && !pathIsUnder(dir, output) {
+			parent := filepath.Dir(output)
+			if parent == output {
+				break
+			}
+			output = parent
+		}
+	}
+	return output
+}
+
+// Returns the header lines, without the comment markers.
+func expandHeaderTemplate(template string, filePaths []string, hints string, markers BufferMarkers) []string {
+	if template == "" {
+		template = DEFAULT_HEADER_TEMPLATE
+	}
+
+	replacer := strings.NewReplacer(
+		"{count}", strconv.Itoa(len(filePaths)),
+		"{directory}", commonDirectory(filePaths),
+		"{comment}", markers.commentMarker(),
+		"{delete}", markers.deleteMarker(),
+		"{appname}", APPNAME,
+	)
+
+	var output []string
+	for _, line := range strings.Split(strings.Replace(template, "\\n", "\n", -1), "\n") {
+		if strings.Contains(line, "{hints}") {
+			line = strings.Replace(replacer.Replace(line), "{hints}", hints, -1)
+		} else {
+			// NOTE: kr/text.Wrap returns lines separated by \n for all platforms.
+			line = text.Wrap(replacer.Replace(line), LINE_LENGTH-3)
+		}
+		output = append(output, strings.Split(line, "\n")...)
+	}
+	return output
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_commonDirectory(t *testing.T) {
+	root := normalizePath("root")
+
+	testCases := []struct {
+		paths    []string
+		expected string
+	}{
+		{[]string{filepath.Join(root, "a", "1"), filepath.Join(root, "a", "2")}, filepath.Join(root, "a")},
+		{[]string{filepath.Join(root, "a", "1"), filepath.Join(root, "b", "c", "2")}, root},
+		{[]string{filepath.Join(root, "a", "b", "1"), filepath.Join(root, "a", "2")}, filepath.Join(root, "a")},
+		{[]string{filepath.Join(root, "ab", "1"), filepath.Join(root, "a", "2")}, root},
+	}
+
+	for _, testCase := range testCases {
+		actual := commonDirectory(testCase.paths)
+		if actual != testCase.expected {
+			t.Errorf("%v: expected \"%s\", got \"%s\"", testCase.paths, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_createListFileContent_markersAndHeader(t *testing.T) {
+	newline_ = "\n"
+
+	dir := normalizePath("photos")
+	paths := []string{filepath.Join(dir, "beach.jpg"), filepath.Join(dir, "sea.jpg")}
+	markers := BufferMarkers{Comment: "#", Delete: "- "}
+
+	content := createListFileContentWithOptions(paths, ListFileOptions{
+		IncludeHeader:  true,
+		HeaderTemplate: "Renaming {count} files in {directory}\\n\\nUse \"{delete}\" to delete a file",
+		Markers:        markers,
+		LockExtensions: true,
+	})
+
+	expected := "# Renaming 2 files in " + dir + "\n#\n# Use \"- \" to delete a file\n\nbeach\t# .jpg\nsea\t# .jpg\n"
+	if content != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, content)
+	}
+
+	// The default header uses the markers in its explanations
+	content = createListFileContentWithOptions(paths, ListFileOptions{IncludeHeader: true, Markers: markers})
+	if !strings.HasPrefix(content, "# Please change") || !strings.Contains(content, "putting \"- \" at") {
+		t.Errorf("Unexpected default header: \"%s\"", content)
+	}
+}
+
+func Test_fileActionsWithOptions_markers(t *testing.T) {
+	newline_ = "\n"
+
+	paths := []string{"/tmp/beach.jpg", "/tmp/sea.jpg", "/tmp/sky.jpg", "/tmp/sun.jpg"}
+	markers := BufferMarkers{Comment: "#", Delete: "- "}
+
+	// "//sea.jpg" is not a comment anymore, "- other" is a new name since it
+	// doesn't start with the comment marker, and "- sun.jpg" deletes the file.
+	content := "# Comment\n- beach.jpg\n//sea.jpg\n- other\n# sun.jpg\n- sun.jpg\n"
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{Markers: markers})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{"delete beach.jpg", "sea.jpg => //sea.jpg", "sky.jpg => - other", "delete sun.jpg"}
+	if len(actions) != len(expected) {
+		t.Fatalf("Expected %d actions, got %d", len(expected), len(actions))
+	}
+
+	for i, action := range actions {
+		actual := filepath.Base(action.oldPath) + " => " + action.newPath
+		if action.kind == KIND_DELETE {
+			actual = "delete " + filepath.Base(action.oldPath)
+		}
+		if actual != expected[i] {
+			t.Errorf("Expected \"%s\", got \"%s\"", expected[i], actual)
+		}
+	}
+
+	// Two-column format
+	content = "# Comment\nsky.jpg => sky.jpg\n- beach.jpg => beach.jpg\nsun.jpg => moon.jpg\n- sea.jpg\n"
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{Markers: markers, TwoColumns: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(actions) != 3 || actions[0].kind != KIND_DELETE || actions[1].newPath != "moon.jpg" || actions[2].kind != KIND_DELETE {
+		t.Errorf("Unexpected actions: %v", actions)
+	}
+
+	// Names that start with the comment marker
+	paths = []string{"/tmp/#notes.txt", "/tmp/sea.jpg"}
+	for _, options := range []FileActionOptions{
+		{Markers: markers},
+		{Markers: markers, LockExtensions: true},
+		{Markers: markers, TwoColumns: true},
+	} {
+		content = createListFileContentWithOptions(paths, ListFileOptions{
+			IncludeHeader:  true,
+			Markers:        markers,
+			LockExtensions: options.LockExtensions,
+			TwoColumns:     options.TwoColumns,
+		})
+
+		actions, err = fileActionsWithOptions(paths, content, options)
+		if err != nil || len(actions) != 0 {
+			t.Errorf("%q: expected no action, got %v, %v", content, actions, err)
+		}
+	}
+
+	actions, err = fileActionsWithOptions(paths, "# Comment\nnotes.md\n# sea.jpg\n- sea.jpg\n", FileActionOptions{Markers: markers})
+	if err != nil || len(actions) != 2 || actions[0].newPath != "notes.md" || actions[1].kind != KIND_DELETE {
+		t.Errorf("Unexpected actions: %v, %v", actions, err)
+	}
+
+	// A header line that is just the comment marker is not the file "#"
+	paths = []string{"/tmp/#", "/tmp/a"}
+	actions, err = fileActionsWithOptions(paths, "# Header\n#\n\nx\na\n", FileActionOptions{Markers: markers})
+	if err != nil || len(actions) != 1 || filepath.Base(actions[0].oldPath) != "#" || actions[0].newPath != "x" {
+		t.Errorf("Unexpected actions: %v, %v", actions, err)
+	}
+
+	actions, err = fileActionsWithOptions(paths, "#\nb\n", FileActionOptions{Markers: markers})
+	if err != nil || len(actions) != 1 || filepath.Base(actions[0].oldPath) != "a" || actions[0].newPath != "b" {
+		t.Errorf("Unexpected actions: %v, %v", actions, err)
+	}
+
+	paths = []string{"/tmp/#notes.txt", "/tmp/sea.jpg"}
+	actions, err = fileActionsWithOptions(paths, "#notes.txt => #todo.txt\n- sea.jpg\n", FileActionOptions{Markers: markers, TwoColumns: true})
+	if err != nil || len(actions) != 2 || actions[0].newPath != "#todo.txt" || actions[1].kind != KIND_DELETE {
+		t.Errorf("Unexpected actions: %v, %v", actions, err)
+	}
+
+	if err := (BufferMarkers{Comment: " "}).validate(); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
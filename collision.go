@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	COLLISION_ABORT  = "abort"
+	COLLISION_NUMBER = "number"
+	COLLISION_SKIP   = "skip"
+)
+
+const DEFAULT_COLLISION_FORMAT = "{name} ({n}){ext}"
+
+// Gives up after this many attempts at finding a free numbered name.
+const COLLISION_MAX_NUMBER = 10000
+
+func checkCollisionPolicy(policy string) error {
+	switch policy {
+	case "", COLLISION_ABORT, COLLISION_NUMBER, COLLISION_SKIP:
+		return nil
+	}
+	return errors.New(fmt.Sprintf("unknown collision policy: \"%s\". Possible values: abort, number, skip", policy))
+}
+
+// Builds the numbered version of the name using the format, in which {name}
+// is replaced by the name without extension, {ext} by the extension and {n}
+// by the number.
+func numberedFilename(name string, format string, n int) string {
+	ext := filepath.Ext(name)
+	output := strings.Replace(format, "{name}", strings.TrimSuffix(name, ext), -1)
+	output = strings.Replace(output, "{ext}", ext, -1)
+	return strings.Replace(output, "{n}", strconv.Itoa(n), -1)
+}
+
+// Applies the collision policy to the rename actions whose destination is
+// already used, either by a file that is not going to be moved or by another
+// action in the batch. With the "number" policy, the first action keeps the
+// name and the following ones get a number. With the "skip" policy, the
+// actions are removed. With the "abort" policy, the actions are returned as
+// they are, and the collisions are reported by fileActions().
+func resolveCollisions(actions []*FileAction, policy string, format string) ([]*FileAction, error) {
+	err := checkCollisionPolicy(policy)
+	if err != nil {
+		return actions, err
+	}
+
+	if policy == "" || policy == COLLISION_ABORT {
+		return actions, nil
+	}
+
+	if format == "" {
+		format = DEFAULT_COLLISION_FORMAT
+	}
+
+	if !strings.Contains(format, "{n}") || strings.ContainsAny(format, "/\\") {
+		return actions, errors.New(fmt.Sprintf("the collision format must contain {n} and no path separator: \"%s\"", format))
+	}
+
+	// A skipped file stays where it is, so the paths that are going to be
+	// free are computed again every time an action is skipped.
+	skipped := make(map[*FileAction]bool)
+	for {
+		output, skippedAction, err := resolveCollisionsPass(actions, skipped, policy, format)
+		if err != nil {
+			return actions, err
+		}
+		if skippedAction == nil {
+			return output, nil
+		}
+
+		logInfo("Line %d: skipping \"%s\": \"%s\" is already used", skippedAction.line, skippedAction.FullOldPath(), skippedAction.FullNewPath())
+		skipped[skippedAction] = true
+	}
+}
+
+// Applies the policy to the actions that have not been skipped. With the
+// "skip" policy, stops at the first collision and returns the action to
+// skip.
+func resolveCollisionsPass(actions []*FileAction, skipped map[*FileAction]bool, policy string, format string) ([]*FileAction, *FileAction, error) {
+	// Paths that are going to be free once the kept actions are done
+	freed := make(map[string]bool)
+	for _, action := range actions {
+		if !skipped[action] && (action.kind == KIND_RENAME || action.kind == KIND_DELETE) {
+			freed[action.FullOldPath()] = true
+		}
+	}
+
+	taken := make(map[string]bool)
+
+	isAvailable := func(action *FileAction, path string) bool {
+		if taken[path] {
+			return false
+		}
+		if freed[path] {
+			return true
+		}
+		info1, err := os.Stat(path)
+		if err != nil {
+			return true
+		}
+		// The destination can be the file itself, for example when changing
+		// the case of a name on a case insensitive file system.
+		info2, err := os.Stat(action.FullOldPath())
+		return err == nil && os.SameFile(info1, info2)
+	}
+
+	var output []*FileAction
+
+	for _, action := range actions {
+		if skipped[action] {
+			continue
+		}
+
+		if action.kind != KIND_RENAME {
+			output = append(output, action)
+			continue
+		}
+
+		if isAvailable(action, action.FullNewPath()) {
+			taken[action.FullNewPath()] = true
+			output = append(output, action)
+			continue
+		}
+
+		if policy == COLLISION_SKIP {
+			return output, action, nil
+		}
+
+		dir, name := filepath.Split(action.newPath)
+		found := false
+		for n := 2; n <= COLLISION_MAX_NUMBER; n++ {
+			newPath := dir + numberedFilename(name, format, n)
+			full := normalizePath(filepath.Join(filepath.Dir(action.oldPath), newPath))
+			if !isAvailable(action, full) {
+				continue
+			}
+
+			logInfo("Line %d: \"%s\" is already used, \"%s\" is going to be used instead", action.line, action.newPath, newPath)
+			action.newPath = newPath
+			taken[full] = true
+			found = true
+			break
+		}
+
+		if !found {
+			return output, nil, errors.New(fmt.Sprintf("could not find a free name for \"%s\"", action.FullNewPath()))
+		}
+
+		if action.FullNewPath() == action.FullOldPath() {
+			continue
+		}
+
+		output = append(output, action)
+	}
+
+	return output, nil, nil
+}
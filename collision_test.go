@@ -0,0 +1,121 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_numberedFilename(t *testing.T) {
+	testCases := [][]string{
+		{"beach.jpg", DEFAULT_COLLISION_FORMAT, "beach (3).jpg"},
+		{"beach.jpg", "{name}_{n}{ext}", "beach_3.jpg"},
+		{"beach", DEFAULT_COLLISION_FORMAT, "beach (3)"},
+		{"archive.tar.gz", "{n}-{name}{ext}", "3-archive.tar.gz"},
+	}
+
+	for _, testCase := range testCases {
+		actual := numberedFilename(testCase[0], testCase[1], 3)
+		if actual != testCase[2] {
+			t.Errorf("Expected \"%s\", got \"%s\"", testCase[2], actual)
+		}
+	}
+}
+
+func Test_fileActionsWithOptions_collisionPolicy(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	var paths []string
+	for _, name := range []string{"a", "b", "c", "beach.jpg", "d"} {
+		paths = append(paths, filepath.Join(tempFolder(), name))
+		touch(paths[len(paths)-1])
+	}
+
+	// "a", "b" and "c" are renamed to the same name, and "d" to the name of
+	// a file that is not being renamed.
+	content := "beach.jpg\nbeach.jpg\nbeach.jpg\nbeach.jpg\nbeach.jpg\n"
+
+	_, err := fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_ABORT})
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_NUMBER})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{"beach (2).jpg", "beach (3).jpg", "beach (4).jpg", "beach (5).jpg"}
+	if len(actions) != len(expected) {
+		t.Fatalf("Expected %d actions, got %d", len(expected), len(actions))
+	}
+	for i, action := range actions {
+		if action.newPath != expected[i] {
+			t.Errorf("Expected \"%s\", got \"%s\"", expected[i], action.newPath)
+		}
+	}
+
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_NUMBER, CollisionFormat: "{name}_{n}{ext}"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if actions[0].newPath != "beach_2.jpg" {
+		t.Errorf("Expected \"beach_2.jpg\", got \"%s\"", actions[0].newPath)
+	}
+
+	// With the skip policy, all the files keep their names since
+	// "beach.jpg" exists and is not renamed.
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_SKIP})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("Expected no action, got %d", len(actions))
+	}
+
+	// Here "beach.jpg" is renamed so its name is free for the first file.
+	content = "beach.jpg\nbeach.jpg\nc\nsea.jpg\nd\n"
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_NUMBER})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected = []string{"beach.jpg", "beach (2).jpg", "sea.jpg"}
+	if len(actions) != len(expected) {
+		t.Fatalf("Expected %d actions, got %d", len(expected), len(actions))
+	}
+	for i, action := range actions {
+		if action.newPath != expected[i] {
+			t.Errorf("Expected \"%s\", got \"%s\"", expected[i], action.newPath)
+		}
+	}
+
+	// "c" keeps its name so "b" is skipped, and then "a" since "b" is not
+	// going to be free anymore.
+	content = "b\nc\nc\nbeach.jpg\nd\n"
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_SKIP})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("Expected no action, got %v", actions)
+	}
+
+	content = "b\nc\nc\nbeach.jpg\ne\n"
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_SKIP})
+	if err != nil || len(actions) != 1 || actions[0].newPath != "e" {
+		t.Errorf("Expected \"d\" to be renamed to \"e\", got %v, %v", actions, err)
+	}
+
+	_, err = fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: "overwrite"})
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+
+	_, err = fileActionsWithOptions(paths, content, FileActionOptions{CollisionPolicy: COLLISION_NUMBER, CollisionFormat: "{name} copy{ext}"})
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
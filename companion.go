@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Companion files (or "sidecar" files) are files such as "IMG_1.xmp" or
+// "IMG_1.CR2.xmp" that belong to a main file, here "IMG_1.CR2", and that
+// must follow it when it is renamed or deleted.
+type companionGroup struct {
+	primaryExtensions   []string // Lowercase, without dot. "*" matches any file.
+	companionExtensions []string // Lowercase, without dot
+}
+
+func splitExtensionList(s string) []string {
+	var output []string
+	for _, ext := range strings.Split(s, ",") {
+		ext = strings.ToLower(strings.TrimLeft(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			output = append(output, ext)
+		}
+	}
+	return output
+}
+
+// Parses groups such as "cr2,nef,jpg:xmp; mp4,mkv:srt,ass", where each group
+// is made of the extensions of the main files and the extensions of their
+// companion files, separated by a colon.
+func parseCompanionGroups(spec string) ([]companionGroup, error) {
+	var output []companionGroup
+	for _, s := range strings.Split(spec, ";") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+
+		parts := strings.Split(s, ":")
+		if len(parts) != 2 {
+			return output, errors.New(fmt.Sprintf("invalid companion file group: \"%s\". Expected format: <extensions>:<companion extensions>. eg. cr2,jpg:xmp", strings.TrimSpace(s)))
+		}
+
+		group := companionGroup{
+			primaryExtensions:   splitExtensionList(parts[0]),
+			companionExtensions: splitExtensionList(parts[1]),
+		}
+
+		if len(group.primaryExtensions) == 0 || len(group.companionExtensions) == 0 {
+			return output, errors.New(fmt.Sprintf("invalid companion file group: \"%s\". Both lists of extensions must be specified", strings.TrimSpace(s)))
+		}
+
+		output = append(output, group)
+	}
+	return output, nil
+}
+
+func extensionInList(name string, list []string) bool {
+	ext := strings.ToLower(strings.TrimLeft(filepath.Ext(name), "."))
+	for _, e := range list {
+		if e == "*" || e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells whether companionName is a companion of primaryName, either as
+// "IMG_1.xmp" or as "IMG_1.CR2.xmp".
+func isCompanionName(primaryName string, companionName string) bool {
+	if primaryName == companionName {
+		return false
+	}
+	companionExt := filepath.Ext(companionName)
+	stem := strings.TrimSuffix(companionName, companionExt)
+	return stem == primaryName || stem == strings.TrimSuffix(primaryName, fileExtension(primaryName))
+}
+
+// Finds the companion files of the given files in their directories. The
+// companion files that are among the given files are removed from them,
+// unless their main file is not there, and the main files are returned
+// along with a map of their companion files.
+func findCompanionFiles(filePaths []string, groups []companionGroup) ([]string, map[string][]string, error) {
+	companions := make(map[string][]string)
+	if len(groups) == 0 {
+		return filePaths, companions, nil
+	}
+
+	dirEntries := make(map[string][]string)
+	claimed := make(map[string]bool)
+
+	for _, filePath := range filePaths {
+		if claimed[normalizePath(filePath)] {
+			continue
+		}
+
+		name := filepath.Base(filePath)
+		dir := filepath.Dir(filePath)
+
+		for _, group := range groups {
+			if !extensionInList(name, group.primaryExtensions) || extensionInList(name, group.companionExtensions) {
+				continue
+			}
+
+			entries, ok := dirEntries[dir]
+			if !ok {
+				files, err := os.ReadDir(dir)
+				if err != nil {
+					return filePaths, companions, err
+				}
+				for _, f := range files {
+					entries = append(entries, f.Name())
+				}
+				dirEntries[dir] = entries
+			}
+
+			for _, entry := range entries {
+				if !extensionInList(entry, group.companionExtensions) || !isCompanionName(name, entry) {
+					continue
+				}
+				companionPath := filepath.Join(dir, entry)
+				if claimed[normalizePath(companionPath)] {
+					continue
+				}
+				claimed[normalizePath(companionPath)] = true
+				companions[filePath] = append(companions[filePath], companionPath)
+			}
+		}
+	}
+
+	var output []string
+	for _, filePath := range filePaths {
+		if claimed[normalizePath(filePath)] && len(companions[filePath]) == 0 {
+			continue
+		}
+		output = append(output, filePath)
+	}
+
+	return output, companions, nil
+}
+
+// Returns the line under which a companion file is shown in the file buffer.
+// It is a comment so it does not need to be matched to a file.
+func companionComment(companionPath string, commentMarker string) string {
+	return commentMarker + "  + " + filepath.Base(companionPath)
+}
+
+// Returns the actions that apply the change made to the main file to its
+// companion files.
+func companionFileActions(action *FileAction, companionPaths []string) []*FileAction {
+	var output []*FileAction
+
+	primaryName := filepath.Base(action.oldPath)
+	primaryStem := strings.TrimSuffix(primaryName, fileExtension(primaryName))
+	newName := filepath.Base(action.newPath)
+	newStem := strings.TrimSuffix(newName, fileExtension(newName))
+	newDir := filepath.Dir(action.newPath)
+
+	for _, companionPath := range companionPaths {
+		companion := NewFileAction()
+		companion.kind = action.kind
+		companion.oldPath = companionPath
+		companion.line = action.line
+
+		if action.kind == KIND_RENAME {
+			companionName := filepath.Base(companionPath)
+			if strings.HasPrefix(companionName, primaryName+".") {
+				companionName = newName + companionName[len(primaryName):]
+			} else {
+				companionName = newStem + companionName[len(primaryStem):]
+			}
+			companion.newPath = filepath.Join(newDir, companionName)
+		}
+
+		output = append(output, companion)
+	}
+
+	return output
+}
+
+// Adds the actions of the companion files after the actions of their main
+// files. It is done once the collisions have been resolved, so that the
+// companion files get the final names of their main files and are left as
+// they are when their main file is skipped. Their names are normalized and
+// validated like the ones of the main files.
+func addCompanionFileActions(actions []*FileAction, options FileActionOptions) ([]*FileAction, error) {
+	if len(options.Companions) == 0 {
+		return actions, nil
+	}
+
+	var output []*FileAction
+	for _, action := range actions {
+		output = append(output, action)
+		if isAttributeAction(action) {
+			// The attributes of the companion files are left as they are
+			continue
+		}
+
+		companionActions, err := normalizeFileActions(companionFileActions(action, options.Companions[action.oldPath]), options.UnicodeNormalization)
+		if err != nil {
+			return []*FileAction{}, err
+		}
+
+		if options.FilenameProfile != "" {
+			companionActions, err = validateFileActions(companionActions, options.FilenameProfile, options.Sanitize)
+			if err != nil {
+				return []*FileAction{}, err
+			}
+		}
+
+		output = append(output, companionActions...)
+	}
+	return output, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseCompanionGroups(t *testing.T) {
+	groups, err := parseCompanionGroups("CR2, .nef:xmp; mp4:srt,ass;")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+
+	if strings.Join(groups[0].primaryExtensions, ",") != "cr2,nef" || strings.Join(groups[1].companionExtensions, ",") != "srt,ass" {
+		t.Errorf("Incorrect groups: %v", groups)
+	}
+
+	for _, spec := range []string{"cr2", "cr2:", ":xmp", "a:b:c"} {
+		_, err := parseCompanionGroups(spec)
+		if err == nil {
+			t.Errorf("Expected an error for \"%s\"", spec)
+		}
+	}
+}
+
+func Test_companionFiles(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	for _, name := range []string{"IMG_1.CR2", "IMG_1.xmp", "IMG_2.CR2", "IMG_2.CR2.xmp", "IMG_3.xmp", "movie.mp4", "movie.srt"} {
+		touch(filepath.Join(tempFolder(), name))
+	}
+
+	groups, _ := parseCompanionGroups("cr2:xmp;mp4:srt")
+
+	// "movie.srt" is not among the files but is found in the directory.
+	// "IMG_3.xmp" has no main file so it stays in the buffer.
+	var paths []string
+	for _, name := range []string{"IMG_1.CR2", "IMG_1.xmp", "IMG_2.CR2", "IMG_3.xmp", "movie.mp4"} {
+		paths = append(paths, filepath.Join(tempFolder(), name))
+	}
+
+	paths, companions, err := findCompanionFiles(paths, groups)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(paths) != 4 || len(companions) != 3 {
+		t.Fatalf("Expected 4 files with 3 of them having companions, got %v, %v", paths, companions)
+	}
+
+	content := createListFileContentWithOptions(paths, ListFileOptions{Companions: companions, ShowCompanions: true})
+	expected := "IMG_1.CR2\n//  + IMG_1.xmp\nIMG_2.CR2\n//  + IMG_2.CR2.xmp\nIMG_3.xmp\nmovie.mp4\n//  + movie.srt\n"
+	if content != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, content)
+	}
+
+	content = "beach.CR2\n//  + IMG_1.xmp\nsub/sea.CR2\n//  + IMG_2.CR2.xmp\nIMG_3.xmp\n//movie.mp4\n"
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{Companions: companions})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	var result []string
+	for _, action := range actions {
+		if action.kind == KIND_DELETE {
+			result = append(result, "delete "+filepath.Base(action.oldPath))
+		} else {
+			result = append(result, filepath.Base(action.oldPath)+" => "+action.newPath)
+		}
+	}
+
+	expected = strings.Join([]string{
+		"IMG_1.CR2 => beach.CR2",
+		"IMG_1.xmp => beach.xmp",
+		"IMG_2.CR2 => " + filepath.Join("sub", "sea.CR2"),
+		"IMG_2.CR2.xmp => " + filepath.Join("sub", "sea.CR2.xmp"),
+		"delete movie.mp4",
+		"delete movie.srt",
+	}, "\n")
+
+	if strings.Join(result, "\n") != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, strings.Join(result, "\n"))
+	}
+
+	// The companion files are included in the conflict checks
+	content = "IMG_3.CR2\nIMG_2.CR2\nIMG_3.xmp\nmovie.mp4\n"
+	_, err = fileActionsWithOptions(paths, content, FileActionOptions{Companions: companions})
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+
+	// The names of the companion files are validated too. Here only
+	// "IMG_2.CR2.xmp" gets a name that is too long.
+	content = "IMG_1.CR2\n" + strings.Repeat("a", 250) + ".CR2\nIMG_3.xmp\nmovie.mp4\n"
+	_, err = fileActionsWithOptions(paths, content, FileActionOptions{Companions: companions, FilenameProfile: "posix"})
+	if err == nil || !strings.Contains(err.Error(), ".CR2.xmp") {
+		t.Errorf("Expected an error about the companion file, got %v", err)
+	}
+
+	err = processFileActions(actions[:4], false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !fileExists(filepath.Join(tempFolder(), "beach.xmp")) || !fileExists(filepath.Join(tempFolder(), "sub", "sea.CR2.xmp")) {
+		t.Error("Companion files have not been renamed")
+	}
+
+	items, _ := allHistoryItems()
+	if len(items) != 4 {
+		t.Errorf("Expected 4 history items, got %d", len(items))
+	}
+}
+
+func Test_companionFiles_collisionPolicy(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	for _, name := range []string{"a.cr2", "a.xmp", "beach.cr2"} {
+		touch(filepath.Join(tempFolder(), name))
+	}
+
+	groups, _ := parseCompanionGroups("cr2:xmp")
+	paths, companions, err := findCompanionFiles([]string{filepath.Join(tempFolder(), "a.cr2"), filepath.Join(tempFolder(), "beach.cr2")}, groups)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	// "a.cr2" is renamed to the name of a file that is not being renamed
+	content := "beach.cr2\nbeach.cr2\n"
+
+	// The companion file is skipped along with its main file
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{Companions: companions, CollisionPolicy: COLLISION_SKIP})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("Expected no action, got %v", actions)
+	}
+
+	// The companion file gets the numbered name of its main file
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{Companions: companions, CollisionPolicy: COLLISION_NUMBER})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(actions) != 2 || actions[0].newPath != "beach (2).cr2" || actions[1].newPath != "beach (2).xmp" {
+		t.Errorf("Unexpected actions: %v", actions)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// The status change time is not available on this system, so the
+// modification time is used instead.
+func fileChangeTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
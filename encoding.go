@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// Decodes the content of a file list as it has been saved by the editor.
+// UTF-16 files (as saved by eg. Notepad) are detected by their byte order
+// mark and converted to UTF-8, and the UTF-8 byte order mark is removed.
+func decodeBuffer(content string) string {
+	if len(content) >= 2 {
+		var order binary.ByteOrder
+		if content[0] == 0xFF && content[1] == 0xFE {
+			order = binary.LittleEndian
+		} else if content[0] == 0xFE && content[1] == 0xFF {
+			order = binary.BigEndian
+		}
+
+		if order != nil {
+			// A trailing odd byte cannot be decoded and is ignored
+			units := make([]uint16, (len(content)-2)/2)
+			for i := range units {
+				units[i] = order.Uint16([]byte(content[2+i*2 : 4+i*2]))
+			}
+			return string(utf16.Decode(units))
+		}
+	}
+
+	return stripBom(content)
+}
+
+// Returns the line ending mostly used in the content, or the one of the
+// platform if the content has a single line. Editors may save the file list
+// with line endings that are not the ones it has been created with.
+func detectNewline(content string) string {
+	crlf := strings.Count(content, "\r\n")
+	lf := strings.Count(content, "\n") - crlf
+
+	if crlf == 0 && lf == 0 {
+		return newline()
+	}
+	if crlf >= lf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// Splits the content into lines, whatever their line endings, so that a
+// buffer with both "\n" and "\r\n" line endings is parsed correctly.
+func bufferLines(content string) []string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// Converts the line endings of the content to the given ones.
+func withNewline(content string, newline string) string {
+	return strings.Join(bufferLines(content), newline)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16Bytes(s string, order binary.ByteOrder) []byte {
+	output := []byte{0xFF, 0xFE}
+	if order == binary.BigEndian {
+		output = []byte{0xFE, 0xFF}
+	}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b := make([]byte, 2)
+		order.PutUint16(b, unit)
+		output = append(output, b...)
+	}
+	return output
+}
+
+func Test_decodeBuffer(t *testing.T) {
+	testCases := []struct {
+		content  []byte
+		expected string
+	}{
+		{[]byte("abc\n"), "abc\n"},
+		{append([]byte{239, 187, 191}, []byte("abc\n")...), "abc\n"},
+		{utf16Bytes("café\r\nñ😀\r\n", binary.LittleEndian), "café\r\nñ😀\r\n"},
+		{utf16Bytes("café\nñ😀\n", binary.BigEndian), "café\nñ😀\n"},
+		{append(utf16Bytes("ab", binary.LittleEndian), 'c'), "ab"},
+		{[]byte{0xFF, 0xFE}, ""},
+		{[]byte{}, ""},
+	}
+
+	for _, testCase := range testCases {
+		actual := decodeBuffer(string(testCase.content))
+		if actual != testCase.expected {
+			t.Errorf("%x: expected \"%s\", got \"%s\"", testCase.content, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_detectNewline(t *testing.T) {
+	newline_ = "\n"
+
+	testCases := map[string]string{
+		"a\r\nb\r\n":    "\r\n",
+		"a\nb\n":        "\n",
+		"a\r\nb\nc\n":   "\n",
+		"a\r\nb\r\nc\n": "\r\n",
+		"a":             "\n",
+	}
+
+	for content, expected := range testCases {
+		if actual := detectNewline(content); actual != expected {
+			t.Errorf("%q: expected %q, got %q", content, expected, actual)
+		}
+	}
+
+	if actual := withNewline("a\nb\r\n", "\r\n"); actual != "a\r\nb\r\n" {
+		t.Errorf("Expected %q, got %q", "a\r\nb\r\n", actual)
+	}
+}
+
+func Test_fileActions_mixedLineEndings(t *testing.T) {
+	paths := []string{"/tmp/one", "/tmp/two", "/tmp/three"}
+
+	// The buffer is parsed the same way whatever the line endings of the
+	// platform.
+	for _, nl := range []string{"\n", "\r\n"} {
+		newline_ = nl
+
+		contents := []string{
+			"// Comment\r\n1\ntwo\r\n3",
+			"// Comment\n1\r\ntwo\n3\r\n\r\n",
+			string(utf16Bytes("// Comment\r\n1\ntwo\r\n3\r\n", binary.LittleEndian)),
+			string(utf16Bytes("1\r\ntwo\n3\n", binary.BigEndian)),
+		}
+
+		for _, content := range contents {
+			actions, err := fileActions(paths, content)
+			if err != nil {
+				t.Fatalf("%q: expected no error, got %s", content, err)
+			}
+			if len(actions) != 2 || actions[0].newPath != "1" || actions[1].newPath != "3" {
+				t.Errorf("%q: unexpected actions: %v", content, actions)
+			}
+		}
+
+		content := "one => 1\r\ntwo => two\nthree => 3\r\n"
+		actions, err := fileActionsWithOptions(paths, content, FileActionOptions{TwoColumns: true})
+		if err != nil || len(actions) != 2 || actions[0].newPath != "1" || actions[1].newPath != "3" {
+			t.Errorf("%q: unexpected actions: %v, %v", content, actions, err)
+		}
+
+		filePaths := filePathsFromString("\xEF\xBB\xBFone\r\n// two\ntwo\r\nthree\n")
+		if len(filePaths) != 3 || filePaths[0] != "one" || filePaths[2] != "three" {
+			t.Errorf("Unexpected file paths: %q", filePaths)
+		}
+	}
+
+	newline_ = "\n"
+}
+
+func Test_liveSession_keepsLineEndings(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	a := filepath.Join(tempFolder(), "a")
+	b := filepath.Join(tempFolder(), "b")
+	touch(a)
+	touch(b)
+
+	listFilePath := filepath.Join(tempFolder(), "list.txt")
+
+	session := liveSession{
+		listFilePath: listFilePath,
+		filePaths:    []string{a, b},
+		operation:    newHistoryOperation(),
+	}
+
+	ioutil.WriteFile(listFilePath, []byte("c\r\nb\r\n"), 0700)
+	err := session.applyChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fileExists(filepath.Join(tempFolder(), "c")) {
+		t.Fatal("File has not been renamed")
+	}
+
+	if fileGetContent(listFilePath) != "c\r\nb\r\n" {
+		t.Errorf("Unexpected file list: %q", fileGetContent(listFilePath))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Separates the name from its extension in the file buffer when the
+// extensions are locked. eg. "beach<TAB>// .jpg"
+func extensionColumnSeparator(commentMarker string) string {
+	return "\t" + commentMarker
+}
+
+// Extensions made of several parts, which are locked as a whole.
+var multiPartExtensions = []string{
+	".tar.gz",
+	".tar.bz2",
+	".tar.xz",
+	".tar.zst",
+	".tar.lz",
+	".tar.lzma",
+	".tar.Z",
+}
+
+// Returns the extension of the name, including the dot. Unlike filepath.Ext,
+// multi-part extensions such as ".tar.gz" are returned as a whole, and
+// hidden files such as ".bashrc" have no extension.
+func fileExtension(name string) string {
+	lowerName := strings.ToLower(name)
+	for _, ext := range multiPartExtensions {
+		if len(name) > len(ext) && strings.HasSuffix(lowerName, strings.ToLower(ext)) {
+			return name[len(name)-len(ext):]
+		}
+	}
+
+	ext := filepath.Ext(name)
+	if ext == name || ext == "." {
+		return ""
+	}
+	return ext
+}
+
+// Returns the line as it is written to the file buffer when the extensions
+// are locked: the name without extension, followed by the extension in a
+// trailing comment.
+func lockedExtensionLine(name string, commentMarker string) string {
+	ext := fileExtension(name)
+	if ext == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, ext) + extensionColumnSeparator(commentMarker) + " " + ext
+}
+
+// Rebuilds the full name from a line written by lockedExtensionLine(). If
+// the extension column has been removed, the original extension is
+// reattached. Changing the extension in the column is the explicit way of
+// changing it, and leaving the column empty ("name<TAB>//") removes it.
+func unlockExtensionLine(line string, originalName string, commentMarker string) string {
+	separator := extensionColumnSeparator(commentMarker)
+	index := strings.LastIndex(line, separator)
+	if index < 0 {
+		return line + fileExtension(originalName)
+	}
+
+	name := line[:index]
+	ext := strings.Trim(line[index+len(separator):], " \t")
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return name + ext
+}
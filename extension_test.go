@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_fileExtension(t *testing.T) {
+	testCases := [][]string{
+		{"beach.jpg", ".jpg"},
+		{"archive.tar.gz", ".tar.gz"},
+		{"ARCHIVE.TAR.BZ2", ".TAR.BZ2"},
+		{"notes.v2.txt", ".txt"},
+		{".bashrc", ""},
+		{".tar.gz", ".gz"},
+		{"README", ""},
+		{"trailing.", ""},
+	}
+
+	for _, testCase := range testCases {
+		actual := fileExtension(testCase[0])
+		if actual != testCase[1] {
+			t.Errorf("\"%s\": expected \"%s\", got \"%s\"", testCase[0], testCase[1], actual)
+		}
+	}
+}
+
+func Test_unlockExtensionLine(t *testing.T) {
+	testCases := [][]string{
+		// line, original name, expected
+		{"sunset\t// .jpg", "beach.jpg", "sunset.jpg"},
+		{"sunset", "beach.jpg", "sunset.jpg"},
+		{"sunset.png", "beach.jpg", "sunset.png.jpg"},
+		{"sunset\t// .jpeg", "beach.jpg", "sunset.jpeg"},
+		{"sunset\t// png", "beach.jpg", "sunset.png"},
+		{"sunset\t//", "beach.jpg", "sunset"},
+		{"backup\t// .tar.gz", "archive.tar.gz", "backup.tar.gz"},
+		{"backup", "archive.tar.gz", "backup.tar.gz"},
+		{"README", "README", "README"},
+	}
+
+	for _, testCase := range testCases {
+		actual := unlockExtensionLine(testCase[0], testCase[1], DEFAULT_COMMENT_MARKER)
+		if actual != testCase[2] {
+			t.Errorf("\"%s\": expected \"%s\", got \"%s\"", testCase[0], testCase[2], actual)
+		}
+	}
+}
+
+func Test_fileActionsWithOptions_lockExtensions(t *testing.T) {
+	newline_ = "\n"
+
+	paths := []string{"/tmp/beach.jpg", "/tmp/archive.tar.gz", "/tmp/README", "/tmp/old.txt", "/tmp/notes.txt"}
+
+	content := createListFileContentWithOptions(paths, ListFileOptions{LockExtensions: true})
+	expected := "beach\t// .jpg\narchive\t// .tar.gz\nREADME\nold\t// .txt\nnotes\t// .txt\n"
+	if content != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, content)
+	}
+
+	// Unchanged buffer
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{LockExtensions: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("Expected no action, got %d", len(actions))
+	}
+
+	content = "sunset\nbackup\t// .tar.gz\nREADME\n//old\t// .txt\nnotes\t// .md\n"
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{LockExtensions: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(actions) != 4 {
+		t.Fatalf("Expected 4 actions, got %d", len(actions))
+	}
+
+	if actions[0].newPath != "sunset.jpg" || actions[1].newPath != "backup.tar.gz" || actions[3].newPath != "notes.md" {
+		t.Errorf("Incorrect new names: %s, %s, %s", actions[0].newPath, actions[1].newPath, actions[3].newPath)
+	}
+
+	if actions[2].kind != KIND_DELETE || actions[2].oldPath != "/tmp/old.txt" {
+		t.Errorf("Expected \"old.txt\" to be deleted")
+	}
+}
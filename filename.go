@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Rules a filename must follow to be valid on a given type of system.
+type FilenameProfile struct {
+	InvalidChars   string // In addition to "/" and NUL, which are never valid
+	ControlChars   bool   // Whether characters 1 to 31 are invalid
+	ReservedNames  bool   // Whether DOS device names such as "CON" are invalid
+	TrailingDots   bool   // Whether trailing dots and spaces are invalid
+	MaxLength      int
+	MaxLengthUtf16 bool // Whether MaxLength is in UTF-16 code units rather than bytes
+	Utf8           bool // Whether names must be valid UTF-8, which is not required by POSIX file systems
+}
+
+var filenameProfiles = map[string]FilenameProfile{
+	"posix": {
+		MaxLength: 255,
+	},
+	"macos": {
+		InvalidChars: ":",
+		MaxLength:    255,
+		Utf8:         true,
+	},
+	"windows": {
+		InvalidChars:   "<>:\"\\|?*",
+		ControlChars:   true,
+		ReservedNames:  true,
+		TrailingDots:   true,
+		MaxLength:      255,
+		MaxLengthUtf16: true,
+		Utf8:           true,
+	},
+	"fat32": {
+		InvalidChars:   "<>:\"\\|?*\x7f",
+		ControlChars:   true,
+		ReservedNames:  true,
+		TrailingDots:   true,
+		MaxLength:      255,
+		MaxLengthUtf16: true,
+		Utf8:           true,
+	},
+}
+
+var reservedFilenames = []string{"CON", "PRN", "AUX", "NUL", "COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9", "LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9"}
+
+// Returns the profile matching the current operating system.
+func defaultFilenameProfile() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "windows"
+	case "darwin":
+		return "macos"
+	}
+	return "posix"
+}
+
+func filenameProfileNames() []string {
+	var output []string
+	for name := range filenameProfiles {
+		output = append(output, name)
+	}
+	sort.Strings(output)
+	return output
+}
+
+func filenameProfileByName(name string) (FilenameProfile, error) {
+	profile, ok := filenameProfiles[strings.ToLower(name)]
+	if !ok {
+		return profile, errors.New(fmt.Sprintf("unknown filename profile: \"%s\". Possible values: %s", name, strings.Join(filenameProfileNames(), ", ")))
+	}
+	return profile, nil
+}
+
+func (this FilenameProfile) isInvalidChar(c rune) bool {
+	if c == '/' || c == 0 {
+		return true
+	}
+	if this.ControlChars && c < 32 {
+		return true
+	}
+	return strings.ContainsRune(this.InvalidChars, c)
+}
+
+func (this FilenameProfile) length(name string) int {
+	if this.MaxLengthUtf16 {
+		return len(utf16.Encode([]rune(name)))
+	}
+	return len(name)
+}
+
+func (this FilenameProfile) isReservedName(name string) bool {
+	if !this.ReservedNames {
+		return false
+	}
+	// "CON", "con.txt" and "CON .txt" are all reserved
+	base := strings.TrimRight(strings.SplitN(name, ".", 2)[0], " ")
+	for _, reserved := range reservedFilenames {
+		if strings.EqualFold(base, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the reasons why the name (a single path component) is not valid,
+// or an empty slice if it is.
+func (this FilenameProfile) validate(name string) []string {
+	var output []string
+
+	var invalidChars []string
+	for _, c := range name {
+		if this.isInvalidChar(c) {
+			invalidChars = append(invalidChars, fmt.Sprintf("%q", c))
+		}
+	}
+	if len(invalidChars) > 0 {
+		output = append(output, "invalid characters: "+strings.Join(invalidChars, ", "))
+	}
+
+	if this.Utf8 && !utf8.ValidString(name) {
+		output = append(output, "invalid UTF-8 sequence")
+	}
+
+	if this.TrailingDots && strings.TrimRight(name, ". ") != name {
+		output = append(output, "name cannot end with a dot or a space")
+	}
+
+	if this.isReservedName(name) {
+		output = append(output, "reserved name")
+	}
+
+	if this.length(name) > this.MaxLength {
+		output = append(output, fmt.Sprintf("name is longer than %d characters", this.MaxLength))
+	}
+
+	return output
+}
+
+// Truncates the name so that it is not longer than the maximum length,
+// preserving the extension if possible.
+func (this FilenameProfile) truncate(name string) string {
+	if this.length(name) <= this.MaxLength {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if this.length(ext) >= this.MaxLength/2 {
+		ext = ""
+	}
+
+	base := strings.TrimSuffix(name, ext)
+	for len(base) > 0 && this.length(base+ext) > this.MaxLength {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+
+	return base + ext
+}
+
+// Returns a version of the name (a single path component) that is valid
+// for the profile.
+func (this FilenameProfile) sanitize(name string) string {
+	if this.Utf8 {
+		name = strings.ToValidUTF8(name, "_")
+	}
+
+	var sanitized strings.Builder
+	for i := 0; i < len(name); {
+		c, size := utf8.DecodeRuneInString(name[i:])
+		if c == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 bytes are left as they are when the profile
+			// allows them
+			sanitized.WriteByte(name[i])
+		} else if this.isInvalidChar(c) {
+			sanitized.WriteRune('_')
+		} else {
+			sanitized.WriteString(name[i : i+size])
+		}
+		i += size
+	}
+	name = sanitized.String()
+
+	if this.TrailingDots {
+		name = strings.TrimRight(name, ". ")
+		if name == "" {
+			name = "_"
+		}
+	}
+
+	if this.isReservedName(name) {
+		parts := strings.SplitN(name, ".", 2)
+		parts[0] = strings.TrimRight(parts[0], " ") + "_"
+		name = strings.Join(parts, ".")
+	}
+
+	return this.truncate(name)
+}
+
+// Splits a new path, as entered in the file buffer, into its components.
+func newPathComponents(newPath string) []string {
+	var output []string
+	for _, component := range strings.Split(filepath.ToSlash(newPath), "/") {
+		if component == "" || component == "." || component == ".." {
+			continue
+		}
+		output = append(output, component)
+	}
+	return output
+}
+
+// Checks that the new names are valid for the given profile. If sanitize is
+// true, the invalid names are rewritten instead, and the actions that end up
+// not changing the name are removed.
+func validateFileActions(actions []*FileAction, profileName string, sanitize bool) ([]*FileAction, error) {
+	profile, err := filenameProfileByName(profileName)
+	if err != nil {
+		return actions, err
+	}
+
+	var output []*FileAction
+	var problems []string
+
+	for _, action := range actions {
+		if action.kind != KIND_RENAME {
+			output = append(output, action)
+			continue
+		}
+
+		if sanitize {
+			newPath := strings.Split(filepath.ToSlash(action.newPath), "/")
+			for i, component := range newPath {
+				if component == "" || component == "." || component == ".." {
+					continue
+				}
+				newPath[i] = profile.sanitize(component)
+			}
+
+			sanitized := filepath.FromSlash(strings.Join(newPath, "/"))
+			if sanitized != action.newPath {
+				logInfo("Line %d: \"%s\" has been changed to \"%s\"", action.line, action.newPath, sanitized)
+				action.newPath = sanitized
+			}
+
+			if action.newPath == filepath.Base(action.oldPath) {
+				continue
+			}
+
+			output = append(output, action)
+			continue
+		}
+
+		for _, component := range newPathComponents(action.newPath) {
+			for _, problem := range profile.validate(component) {
+				problems = append(problems, fmt.Sprintf("line %d: \"%s\": %s", action.line, component, problem))
+			}
+		}
+
+		output = append(output, action)
+	}
+
+	if len(problems) > 0 {
+		return actions, errors.New(fmt.Sprintf("some filenames are not valid for the \"%s\" profile (use --sanitize to fix them automatically):\n%s", strings.ToLower(profileName), strings.Join(problems, "\n")))
+	}
+
+	return output, nil
+}
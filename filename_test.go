@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_FilenameProfile_validate(t *testing.T) {
+	type TestCase struct {
+		profile string
+		name    string
+		valid   bool
+	}
+
+	testCases := []TestCase{
+		{"posix", "a:b?.txt", true},
+		{"posix", "CON", true},
+		{"posix", strings.Repeat("a", 256), false},
+		{"macos", "a:b", false},
+		{"windows", "a:b", false},
+		{"windows", "abcd?", false},
+		{"windows", "abcd.", false},
+		{"windows", "abcd ", false},
+		{"windows", "con.txt", false},
+		{"windows", "COM1", false},
+		{"windows", "CONSOLE.txt", true},
+		{"windows", "a\tb", false},
+		{"windows", strings.Repeat("é", 255), true},
+		{"posix", strings.Repeat("é", 255), false},
+		{"posix", "caf\xe9.txt", true},
+		{"macos", "caf\xe9.txt", false},
+		{"windows", "caf\xe9.txt", false},
+		{"fat32", "a\x7fb", false},
+		{"windows", "normal name.txt", true},
+	}
+
+	for _, testCase := range testCases {
+		profile, _ := filenameProfileByName(testCase.profile)
+		problems := profile.validate(testCase.name)
+		if (len(problems) == 0) != testCase.valid {
+			t.Errorf("%s: \"%s\": expected valid = %t, got %v", testCase.profile, testCase.name, testCase.valid, problems)
+		}
+	}
+
+	_, err := filenameProfileByName("amiga")
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func Test_FilenameProfile_sanitize(t *testing.T) {
+	profile, _ := filenameProfileByName("windows")
+
+	testCases := [][]string{
+		{"a:b?.txt", "a_b_.txt"},
+		{"abcd. . ", "abcd"},
+		{"CON.txt", "CON_.txt"},
+		{"aux", "aux_"},
+		{"...", "_"},
+		{"valid.txt", "valid.txt"},
+	}
+
+	for _, testCase := range testCases {
+		r := profile.sanitize(testCase[0])
+		if r != testCase[1] {
+			t.Errorf("Expected \"%s\", got \"%s\"", testCase[1], r)
+		}
+		if len(profile.validate(r)) > 0 {
+			t.Errorf("Sanitized name is not valid: \"%s\"", r)
+		}
+	}
+
+	if r := profile.sanitize("caf\xe9.txt"); r != "caf_.txt" {
+		t.Errorf("Expected \"caf_.txt\", got %q", r)
+	}
+
+	// Latin-1 names are valid on Linux
+	posix, _ := filenameProfileByName("posix")
+	if r := posix.sanitize("caf\xe9.txt"); r != "caf\xe9.txt" {
+		t.Errorf("Expected %q, got %q", "caf\xe9.txt", r)
+	}
+
+	long := posix.sanitize(strings.Repeat("\xe9", 300) + ".txt")
+	if long != strings.Repeat("\xe9", 251)+".txt" {
+		t.Errorf("Name has not been truncated correctly: %q", long)
+	}
+
+	long = profile.sanitize(strings.Repeat("a", 300) + ".jpg")
+	if len(long) != 255 || !strings.HasSuffix(long, ".jpg") {
+		t.Errorf("Name has not been truncated correctly: %d", len(long))
+	}
+}
+
+func Test_fileActionsWithOptions_filenameProfile(t *testing.T) {
+	newline_ = "\n"
+	minLogLevel_ = 10
+
+	paths := []string{"abcd", "efgh", "ijkl"}
+	content := "a:b\nefgh\nCON\n"
+
+	_, err := fileActionsWithOptions(paths, content, FileActionOptions{FilenameProfile: "windows"})
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	if strings.Index(err.Error(), "line 1") < 0 || strings.Index(err.Error(), "line 3") < 0 {
+		t.Errorf("Error does not report the lines: %s", err)
+	}
+
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{FilenameProfile: "windows", Sanitize: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(actions) != 2 || actions[0].newPath != "a_b" || actions[1].newPath != "CON_" {
+		t.Errorf("Names have not been sanitized: %v", actions)
+	}
+
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{FilenameProfile: "posix"})
+	if err != nil || len(actions) != 2 {
+		t.Errorf("Expected no error and 2 actions, got %s and %d", err, len(actions))
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// The glob patterns support, in addition to the filepath.Match syntax:
+//
+//   - "**" as a path component, which matches any number of directories
+//   - "{a,b}" alternatives, which can be nested
+//   - "[!abc]" as well as "[^abc]" for negated character classes
+//
+// Path arguments starting with "!" are negated patterns, which remove the
+// files they match from the files matched by the other arguments, unless a
+// file with this name exists.
+
+// Tells whether the string contains glob characters.
+func hasGlobChars(s string) bool {
+	return strings.ContainsAny(s, "*?[{")
+}
+
+// Backslash escapes special characters, except on Windows where it is the
+// path separator (same as filepath.Match).
+func globEscapeChar() bool {
+	return runtime.GOOS != "windows"
+}
+
+// Expands the "{a,b}" alternatives of the pattern. eg. "*.{jpg,png}"
+// returns "*.jpg" and "*.png".
+func expandBraces(pattern string) []string {
+	start := -1
+	depth := 0
+	var commas []int
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '\\' && globEscapeChar() {
+			i++
+			continue
+		}
+
+		switch c {
+		case '{':
+			if depth == 0 {
+				start = i
+				commas = nil
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			// "{a}" is not an alternative, so it is matched literally
+			if len(commas) == 0 {
+				start = -1
+				continue
+			}
+
+			prefix := pattern[:start]
+			suffix := pattern[i+1:]
+			var output []string
+			previous := start
+			for _, index := range append(commas, i) {
+				alternative := pattern[previous+1 : index]
+				for _, expanded := range expandBraces(prefix + alternative + suffix) {
+					output = append(output, expanded)
+				}
+				previous = index
+			}
+			return output
+		}
+	}
+
+	return []string{pattern}
+}
+
+// Converts the pattern component to the filepath.Match syntax.
+func toMatchPattern(pattern string) string {
+	return strings.Replace(pattern, "[!", "[^", -1)
+}
+
+// Matches a single path component.
+func matchGlobComponent(pattern string, name string) (bool, error) {
+	return filepath.Match(toMatchPattern(pattern), name)
+}
+
+// Matches a slash-separated path against a slash-separated pattern. Each
+// component is matched with matchGlobComponent(), and a "**" component
+// matches any number of components, including none.
+func matchPathPattern(pattern string, path string) bool {
+	pathComponents := strings.Split(path, "/")
+	for _, p := range expandBraces(pattern) {
+		if matchPathComponents(strings.Split(p, "/"), pathComponents) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPathComponents(pattern []string, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchPathComponents(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+
+		ok, err := matchGlobComponent(pattern[0], path[0])
+		if err != nil || !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		path = path[1:]
+	}
+
+	return len(path) == 0
+}
+
+func joinGlobPath(dir string, name string) string {
+	if dir == "" {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+// Returns the directory and all its sub-directories, except those for which
+// skipDir returns true (and their content). Symbolic links are not followed.
+func globSubDirs(dir string, skipDir func(string) bool) []string {
+	output := []string{dir}
+	entries, err := os.ReadDir(dirOrCurrent(dir))
+	if err != nil {
+		return output
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		subDir := joinGlobPath(dir, entry.Name())
+		if skipDir != nil && skipDir(subDir) {
+			continue
+		}
+		output = append(output, globSubDirs(subDir, skipDir)...)
+	}
+	return output
+}
+
+func dirOrCurrent(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
+
+// Returns the paths that match the pattern, which must not contain braces.
+// The directories matched by a glob component are not searched if skipDir
+// returns true for them.
+func globComponents(dir string, components []string, skipDir func(string) bool) ([]string, error) {
+	if len(components) == 0 {
+		if _, err := os.Lstat(dirOrCurrent(dir)); err != nil {
+			return []string{}, nil
+		}
+		return []string{dir}, nil
+	}
+
+	component := components[0]
+	rest := components[1:]
+
+	if component == "**" {
+		var output []string
+		for _, subDir := range globSubDirs(dir, skipDir) {
+			if len(rest) == 0 {
+				// A trailing "**" matches everything below the directory
+				if subDir != dir {
+					output = append(output, subDir)
+				}
+				matches, err := globComponents(subDir, []string{"*"}, skipDir)
+				if err != nil {
+					return output, err
+				}
+				for _, match := range matches {
+					if info, err := os.Lstat(match); err == nil && !info.IsDir() {
+						output = append(output, match)
+					}
+				}
+				continue
+			}
+
+			matches, err := globComponents(subDir, rest, skipDir)
+			if err != nil {
+				return output, err
+			}
+			output = append(output, matches...)
+		}
+		return output, nil
+	}
+
+	if component == "" || !hasGlobChars(component) {
+		if component == "" {
+			// Leading slash of an absolute path
+			return globComponents(string(filepath.Separator), rest, skipDir)
+		}
+		return globComponents(joinGlobPath(dir, component), rest, skipDir)
+	}
+
+	// Checks that the pattern is valid even if the directory is empty
+	if _, err := matchGlobComponent(component, ""); err != nil {
+		return []string{}, err
+	}
+
+	entries, err := os.ReadDir(dirOrCurrent(dir))
+	if err != nil {
+		return []string{}, nil
+	}
+
+	var output []string
+	for _, entry := range entries {
+		ok, _ := matchGlobComponent(component, entry.Name())
+		if !ok {
+			continue
+		}
+		path := joinGlobPath(dir, entry.Name())
+		if len(rest) > 0 && skipDir != nil && skipDir(path) {
+			continue
+		}
+		matches, err := globComponents(path, rest, skipDir)
+		if err != nil {
+			return output, err
+		}
+		output = append(output, matches...)
+	}
+	return output, nil
+}
+
+// Returns the sorted paths that match the pattern.
+func globPaths(pattern string) ([]string, error) {
+	return globPathsWithSkipDir(pattern, nil)
+}
+
+// Same as globPaths(), but the directories for which skipDir returns true are
+// not searched, so that eg. "**/*.js" does not return the files inside an
+// excluded directory.
+func globPathsWithSkipDir(pattern string, skipDir func(string) bool) ([]string, error) {
+	var output []string
+	done := make(map[string]bool)
+
+	for _, p := range expandBraces(pattern) {
+		p = filepath.ToSlash(p)
+
+		dir := ""
+		if volume := filepath.VolumeName(filepath.FromSlash(p)); volume != "" {
+			dir = volume + string(filepath.Separator)
+			p = strings.TrimLeft(p[len(volume):], "/")
+		}
+
+		var components []string
+		for i, component := range strings.Split(p, "/") {
+			if component == "" && i > 0 {
+				continue
+			}
+			components = append(components, component)
+		}
+
+		matches, err := globComponents(dir, components, skipDir)
+		if err != nil {
+			return []string{}, errors.New(fmt.Sprintf("invalid pattern \"%s\": %s", pattern, err))
+		}
+
+		for _, match := range matches {
+			if done[match] {
+				continue
+			}
+			done[match] = true
+			output = append(output, match)
+		}
+	}
+
+	sort.Strings(output)
+	return output, nil
+}
+
+// Tells whether the path matches the negated pattern argument (without its
+// "!"). Relative patterns are matched against the end of the path.
+func matchNegatedPattern(pattern string, path string) bool {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	path = filepath.ToSlash(filepath.Clean(path))
+	if matchPathPattern(pattern, path) {
+		return true
+	}
+	return !filepath.IsAbs(pattern) && matchPathPattern("**/"+pattern, filepath.ToSlash(normalizePath(path)))
+}
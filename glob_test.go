@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_matchPathPattern(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"*.o", "main.o", true},
+		{"*.o", "build/main.o", false},
+		{"build/*.o", "build/main.o", true},
+		{"**/*.o", "main.o", true},
+		{"**/*.o", "a/b/main.o", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**", "a/x/y", true},
+		{"a/**", "b/x", false},
+	}
+
+	for _, testCase := range testCases {
+		actual := matchPathPattern(testCase.pattern, testCase.path)
+		if actual != testCase.expected {
+			t.Errorf("\"%s\" / \"%s\": expected %t, got %t", testCase.pattern, testCase.path, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_matchPathPattern_extended(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"*.{jpg,png}", "a.png", true},
+		{"*.{jpg,png}", "a.gif", false},
+		{"{a,b{c,d}}.txt", "bd.txt", true},
+		{"{a}.txt", "{a}.txt", true},
+		{"[!abc].txt", "d.txt", true},
+		{"[!abc].txt", "a.txt", false},
+		{"[^abc].txt", "a.txt", false},
+		{"file[0-9].txt", "file5.txt", true},
+	}
+
+	for _, testCase := range testCases {
+		actual := matchPathPattern(testCase.pattern, testCase.path)
+		if actual != testCase.expected {
+			t.Errorf("\"%s\" / \"%s\": expected %t, got %t", testCase.pattern, testCase.path, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_expandBraces(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		expected string
+	}{
+		{"*.{jpg,png}", "*.jpg|*.png"},
+		{"{a,b}{1,2}", "a1|a2|b1|b2"},
+		{"{a,{b,c}}", "a|b|c"},
+		{"{a}", "{a}"},
+		{"none", "none"},
+	}
+
+	for _, testCase := range testCases {
+		actual := strings.Join(expandBraces(testCase.pattern), "|")
+		if actual != testCase.expected {
+			t.Errorf("\"%s\": expected %s, got %s", testCase.pattern, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_filePathsFromArgs_globs(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	dir := tempFolder()
+	for _, name := range []string{"a.jpg", "b.png", "c.gif", "sub/d.jpg", "sub/deep/e.png", "sub/thumbnails/f.jpg", "x[1].jpg"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		touch(path)
+	}
+
+	relative := func(paths []string) string {
+		var output []string
+		for _, p := range paths {
+			rel, _ := filepath.Rel(dir, p)
+			output = append(output, filepath.ToSlash(rel))
+		}
+		return strings.Join(output, ",")
+	}
+
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"*.{jpg,png}"}, "a.jpg,b.png,x[1].jpg"},
+		{[]string{"**/*.jpg"}, "a.jpg,sub/d.jpg,sub/thumbnails/f.jpg,x[1].jpg"},
+		{[]string{"**/*.{jpg,png}", "!**/thumbnails/*"}, "a.jpg,b.png,sub/d.jpg,sub/deep/e.png,x[1].jpg"},
+		{[]string{"[!ab].*"}, "c.gif"},
+		{[]string{"sub/**"}, "sub/d.jpg,sub/deep,sub/deep/e.png,sub/thumbnails,sub/thumbnails/f.jpg"},
+		{[]string{"x[1].jpg"}, "x[1].jpg"},
+		{[]string{"*.jpg", "a.*"}, "a.jpg,x[1].jpg"},
+	}
+
+	for _, testCase := range testCases {
+		var args []string
+		for _, arg := range testCase.args {
+			if arg[0] == '!' {
+				args = append(args, arg)
+			} else {
+				args = append(args, filepath.Join(dir, arg))
+			}
+		}
+
+		filePaths, err := filePathsFromArgs(args, true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		actual := relative(filePaths)
+		if actual != testCase.expected {
+			t.Errorf("%v: expected %s, got %s", testCase.args, testCase.expected, actual)
+		}
+	}
+
+	_, err := filePathsFromArgs([]string{filepath.Join(dir, "[a-")}, true)
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
+
+func Test_filePathsFromArgs_exclamationMark(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	for _, name := range []string{"!a.jpg", "a.jpg", "b.jpg"} {
+		touch(filepath.Join(tempFolder(), name))
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.Chdir(tempFolder())
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(currentDir)
+
+	// An existing file is used as is, otherwise it is a negated pattern
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"!a.jpg"}, "!a.jpg"},
+		{[]string{"*.jpg", "!b.*"}, "!a.jpg,a.jpg"},
+	}
+
+	for _, testCase := range testCases {
+		filePaths, err := filePathsFromArgs(testCase.args, true)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		actual := strings.Join(filePaths, ",")
+		if actual != testCase.expected {
+			t.Errorf("%v: expected %s, got %s", testCase.args, testCase.expected, actual)
+		}
+	}
+}
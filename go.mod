@@ -9,4 +9,6 @@ require (
 	github.com/laurent22/go-trash v0.0.0-20150202180955-681610e5e1bc
 	github.com/mattn/go-sqlite3 v0.0.0-20150127001921-25d045f12a64
 	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d
+	golang.org/x/sys v0.30.0
+	golang.org/x/text v0.22.0
 )
@@ -1,16 +1,39 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/nu7hatch/gouuid"
 )
 
+// History items older than this (in seconds) are deleted when the
+// application exits.
+const HISTORY_MAX_AGE = 60 * 60 * 24 * 7
+
+// Columns selected by the history queries. The columns that have been added
+// after the first version of the history table can be NULL for old items.
+const HISTORY_COLUMNS = "id, source, destination, timestamp, IFNULL(operation_id, ''), IFNULL(username, ''), IFNULL(host, ''), IFNULL(cwd, ''), IFNULL(kind, 1), IFNULL(previous_value, ''), IFNULL(value, ''), IFNULL(imported, 0)"
+
 type HistoryItem struct {
 	Source           string
 	Dest             string
 	Timestamp        int64
 	Id               string
 	IntermediatePath string
+	OperationId      string
+	User             string
+	Host             string
+	Cwd              string
+	Kind             int
+	PreviousValue    string // Previous mtime (RFC 3339) or mode (octal) of a KIND_TOUCH or KIND_CHMOD item
+	Value            string // New mtime or mode
+	Imported         bool   // Imported by --history-import, in which case the item is kept whatever its age
 }
 
 func normalizePath(p string) string {
@@ -24,30 +47,112 @@ func normalizePath(p string) string {
 	return output
 }
 
+// Tells whether the path is inside the directory. Both paths must be
+// normalized.
+func pathIsUnder(path string, dir string) bool {
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
 func clearHistory() error {
 	_, err := profileDb_.Exec("DELETE FROM history")
 	return err
 }
 
+func scanHistoryItem(rows *sql.Rows) HistoryItem {
+	var item HistoryItem
+	rows.Scan(&item.Id, &item.Source, &item.Dest, &item.Timestamp, &item.OperationId, &item.User, &item.Host, &item.Cwd, &item.Kind, &item.PreviousValue, &item.Value, &item.Imported)
+	return item
+}
+
 func allHistoryItems() ([]HistoryItem, error) {
 	var output []HistoryItem
 
-	rows, err := profileDb_.Query("SELECT id, source, destination, timestamp FROM history ORDER BY id")
+	rows, err := profileDb_.Query("SELECT " + HISTORY_COLUMNS + " FROM history ORDER BY id")
 	if err != nil {
 		return output, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
+		output = append(output, scanHistoryItem(rows))
+	}
+
+	return output, nil
+}
+
+func currentUserName() string {
+	u, err := user.Current()
+	if err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// Identifies the items that are undone together.
+type historyOperation struct {
+	id        string
+	timestamp int64
+}
+
+func newHistoryOperation() *historyOperation {
+	u, _ := uuid.NewV4()
+	return &historyOperation{id: u.String(), timestamp: time.Now().Unix()}
+}
+
+// Creates a history item for each action. All the items get the same
+// operation ID and timestamp, so that they can be undone together.
+func newHistoryItems(fileActions []*FileAction) []HistoryItem {
+	return newOperationHistoryItems(fileActions, newHistoryOperation())
+}
+
+// Same as newHistoryItems() but for an existing operation, so that actions
+// done at different times can be undone together.
+func newOperationHistoryItems(fileActions []*FileAction, operation *historyOperation) []HistoryItem {
+	var output []HistoryItem
+
+	host, _ := os.Hostname()
+	cwd, _ := os.Getwd()
+	userName := currentUserName()
+
+	for _, action := range fileActions {
+		if action.kind == KIND_DELETE {
+			// Current, undo is not supported
+			continue
+		}
+
 		var item HistoryItem
-		rows.Scan(&item.Id, &item.Source, &item.Dest, &item.Timestamp)
+		item.Source = action.FullOldPath()
+		item.Dest = action.FullNewPath()
+		item.Timestamp = operation.timestamp
+		item.OperationId = operation.id
+		item.User = userName
+		item.Host = host
+		item.Cwd = cwd
+		item.Kind = action.kind
+
+		switch action.kind {
+		case KIND_TOUCH:
+			item.PreviousValue = action.previousMtime.Format(time.RFC3339Nano)
+			item.Value = action.mtime.Format(time.RFC3339Nano)
+		case KIND_CHMOD:
+			item.PreviousValue = formatMode(action.previousMode)
+			item.Value = formatMode(action.mode)
+		}
+
 		output = append(output, item)
 	}
 
-	return output, nil
+	return output
 }
 
-func saveHistoryItems(fileActions []*FileAction) error {
-	if len(fileActions) == 0 {
+func insertHistoryItems(items []HistoryItem) error {
+	if len(items) == 0 {
 		return nil
 	}
 
@@ -56,17 +161,33 @@ func saveHistoryItems(fileActions []*FileAction) error {
 		return err
 	}
 
-	for _, action := range fileActions {
-		if action.kind == KIND_DELETE {
-			// Current, undo is not supported
-			continue
+	for _, item := range items {
+		_, err = tx.Exec("INSERT INTO history (source, destination, timestamp, operation_id, username, host, cwd, kind, previous_value, value, imported) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", item.Source, item.Dest, item.Timestamp, item.OperationId, item.User, item.Host, item.Cwd, item.Kind, item.PreviousValue, item.Value, item.Imported)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
-		tx.Exec("INSERT INTO history (source, destination, timestamp) VALUES (?, ?, ?)", action.FullOldPath(), action.FullNewPath(), time.Now().Unix())
 	}
 
 	return tx.Commit()
 }
 
+func saveHistoryItems(fileActions []*FileAction) error {
+	if len(fileActions) == 0 {
+		return nil
+	}
+
+	return insertHistoryItems(newHistoryItems(fileActions))
+}
+
+func saveOperationHistoryItems(fileActions []*FileAction, operation *historyOperation) error {
+	if len(fileActions) == 0 {
+		return nil
+	}
+
+	return insertHistoryItems(newOperationHistoryItems(fileActions, operation))
+}
+
 func deleteHistoryItems(items []HistoryItem) error {
 	if len(items) == 0 {
 		return nil
@@ -87,7 +208,9 @@ func deleteHistoryItems(items []HistoryItem) error {
 
 func deleteOldHistoryItems(minTimestamp int64) {
 	if profileDb_ != nil {
-		profileDb_.Exec("DELETE FROM history WHERE timestamp < ?", minTimestamp)
+		// The imported items are kept since they have been explicitly
+		// added to the history, however old they are.
+		profileDb_.Exec("DELETE FROM history WHERE timestamp < ? AND IFNULL(imported, 0) = 0", minTimestamp)
 	}
 }
 
@@ -107,21 +230,49 @@ func latestHistoryItemsByDestinations(paths []string) ([]HistoryItem, error) {
 		sqlOr += "destination = ?"
 	}
 
-	rows, err := profileDb_.Query("SELECT id, source, destination, timestamp FROM history WHERE "+sqlOr+" ORDER BY timestamp DESC", sqlArgs...)
+	rows, err := profileDb_.Query("SELECT "+HISTORY_COLUMNS+" FROM history WHERE "+sqlOr+" ORDER BY timestamp DESC, id DESC", sqlArgs...)
 	if err != nil {
 		return output, err
 	}
+	defer rows.Close()
 
-	doneDestinations := make(map[string]bool)
+	// A file can have several items in the same operation (eg. a rename and
+	// a change of mode), which are all part of the latest change.
+	doneDestinations := make(map[string]string)
 	for rows.Next() {
-		var item HistoryItem
-		rows.Scan(&item.Id, &item.Source, &item.Dest, &item.Timestamp)
-		_, done := doneDestinations[item.Dest]
-		if done {
+		item := scanHistoryItem(rows)
+		operationKey := fmt.Sprintf("%s-%d", item.OperationId, item.Timestamp)
+		if key, done := doneDestinations[item.Dest]; done && key != operationKey {
+			continue
+		}
+		output = append(output, item)
+		doneDestinations[item.Dest] = operationKey
+	}
+
+	return output, nil
+}
+
+// Returns the history items whose destination is inside the given directory
+// and whose timestamp is greater or equal to minTimestamp. If the directory
+// is empty, all the destinations match. The most recent items come first,
+// which is the order in which they must be undone.
+func historyItemsUnder(dir string, minTimestamp int64) ([]HistoryItem, error) {
+	var output []HistoryItem
+
+	dir = normalizePath(dir)
+
+	rows, err := profileDb_.Query("SELECT "+HISTORY_COLUMNS+" FROM history WHERE timestamp >= ? ORDER BY timestamp DESC, id DESC", minTimestamp)
+	if err != nil {
+		return output, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := scanHistoryItem(rows)
+		if dir != "" && !pathIsUnder(item.Dest, dir) {
 			continue
 		}
 		output = append(output, item)
-		doneDestinations[item.Dest] = true
 	}
 
 	return output, nil
@@ -60,6 +60,14 @@ func Test_saveHistoryItems(t *testing.T) {
 		t.Errorf("Expected 3 items, got %d", len(items))
 	}
 
+	if items[0].OperationId == "" || items[0].OperationId != items[1].OperationId || items[0].OperationId == items[2].OperationId {
+		t.Error("Items saved together should have the same operation ID")
+	}
+
+	if items[0].Kind != KIND_RENAME || items[0].Cwd == "" {
+		t.Error("Item details have not been saved")
+	}
+
 	profileDb_.Close()
 
 	err = saveHistoryItems(fileActions)
@@ -142,3 +150,35 @@ func Test_latestHistoryItemsByDestinations(t *testing.T) {
 		}
 	}
 }
+
+func Test_historyItemsUnder(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	photos := normalizePath(filepath.Join(tempFolder(), "photos"))
+	photosOld := normalizePath(filepath.Join(tempFolder(), "photos-old"))
+
+	profileDb_.Exec("INSERT INTO history (source, destination, timestamp) VALUES (?, ?, ?)", "a", filepath.Join(photos, "1"), 1000)
+	profileDb_.Exec("INSERT INTO history (source, destination, timestamp) VALUES (?, ?, ?)", "b", filepath.Join(photos, "sub", "2"), 1001)
+	profileDb_.Exec("INSERT INTO history (source, destination, timestamp) VALUES (?, ?, ?)", "c", filepath.Join(photosOld, "3"), 1002)
+	profileDb_.Exec("INSERT INTO history (source, destination, timestamp) VALUES (?, ?, ?)", "d", photos, 1003)
+
+	items, _ := historyItemsUnder(photos, 0)
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	if items[0].Source != "b" || items[1].Source != "a" {
+		t.Error("Items are not in the right order")
+	}
+
+	items, _ = historyItemsUnder(photos, 1001)
+	if len(items) != 1 || items[0].Source != "b" {
+		t.Error("Did not get the right items")
+	}
+
+	items, _ = historyItemsUnder("", 1002)
+	if len(items) != 2 {
+		t.Errorf("Expected 2 items, got %d", len(items))
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Columns of the exported history logs, in the order they appear in CSV files.
+var historyLogColumns = []string{"operation_id", "timestamp", "user", "host", "cwd", "source", "destination", "kind", "previous_value", "value"}
+
+// Columns that are not in the logs exported by older versions.
+var optionalHistoryLogColumns = map[string]bool{"previous_value": true, "value": true}
+
+type HistoryLogEntry struct {
+	OperationId   string `json:"operation_id"`
+	Timestamp     string `json:"timestamp"`
+	User          string `json:"user"`
+	Host          string `json:"host"`
+	Cwd           string `json:"cwd"`
+	Source        string `json:"source"`
+	Destination   string `json:"destination"`
+	Kind          string `json:"kind"`
+	PreviousValue string `json:"previous_value,omitempty"`
+	Value         string `json:"value,omitempty"`
+}
+
+func actionKindToString(kind int) string {
+	switch kind {
+	case KIND_RENAME:
+		return "rename"
+	case KIND_DELETE:
+		return "delete"
+	case KIND_TOUCH:
+		return "touch"
+	case KIND_CHMOD:
+		return "chmod"
+	}
+	return fmt.Sprintf("%d", kind)
+}
+
+func actionKindFromString(s string) (int, error) {
+	switch s {
+	case "rename", "":
+		return KIND_RENAME, nil
+	case "delete":
+		return KIND_DELETE, nil
+	case "touch":
+		return KIND_TOUCH, nil
+	case "chmod":
+		return KIND_CHMOD, nil
+	}
+	return 0, errors.New(fmt.Sprintf("unknown kind: \"%s\"", s))
+}
+
+func historyItemToLogEntry(item HistoryItem) HistoryLogEntry {
+	return HistoryLogEntry{
+		OperationId:   item.OperationId,
+		Timestamp:     time.Unix(item.Timestamp, 0).Format(time.RFC3339),
+		User:          item.User,
+		Host:          item.Host,
+		Cwd:           item.Cwd,
+		Source:        item.Source,
+		Destination:   item.Dest,
+		Kind:          actionKindToString(item.Kind),
+		PreviousValue: item.PreviousValue,
+		Value:         item.Value,
+	}
+}
+
+func historyLogEntryToItem(entry HistoryLogEntry) (HistoryItem, error) {
+	var item HistoryItem
+
+	t, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil {
+		return item, errors.New(fmt.Sprintf("invalid timestamp: \"%s\"", entry.Timestamp))
+	}
+
+	kind, err := actionKindFromString(entry.Kind)
+	if err != nil {
+		return item, err
+	}
+
+	if entry.Source == "" || entry.Destination == "" {
+		return item, errors.New("source and destination cannot be empty")
+	}
+
+	if (kind == KIND_TOUCH || kind == KIND_CHMOD) && entry.PreviousValue == "" {
+		return item, errors.New(fmt.Sprintf("the previous value of \"%s\" cannot be empty", entry.Destination))
+	}
+
+	item.OperationId = entry.OperationId
+	item.Timestamp = t.Unix()
+	item.User = entry.User
+	item.Host = entry.Host
+	item.Cwd = entry.Cwd
+	item.Source = entry.Source
+	item.Dest = entry.Destination
+	item.Kind = kind
+	item.PreviousValue = entry.PreviousValue
+	item.Value = entry.Value
+	return item, nil
+}
+
+// Returns "csv" or "json" depending on the extension of the file.
+func historyLogFormat(filePath string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == ".csv" || ext == ".json" {
+		return ext[1:], nil
+	}
+	return "", errors.New(fmt.Sprintf("unsupported history log format: \"%s\". The file extension must be .csv or .json", filePath))
+}
+
+func writeHistoryLog(w io.Writer, format string, entries []HistoryLogEntry) error {
+	if format == "json" {
+		if entries == nil {
+			entries = []HistoryLogEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		return encoder.Encode(entries)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(historyLogColumns)
+	for _, e := range entries {
+		writer.Write([]string{e.OperationId, e.Timestamp, e.User, e.Host, e.Cwd, e.Source, e.Destination, e.Kind, e.PreviousValue, e.Value})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func readHistoryLog(r io.Reader, format string) ([]HistoryLogEntry, error) {
+	var output []HistoryLogEntry
+
+	if format == "json" {
+		err := json.NewDecoder(r).Decode(&output)
+		return output, err
+	}
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return output, err
+	}
+
+	if len(records) == 0 {
+		return output, nil
+	}
+
+	// Map the header to the column indexes so that the columns can be in
+	// any order.
+	indexes := make(map[string]int)
+	for i, name := range records[0] {
+		indexes[strings.Trim(name, " \t")] = i
+	}
+
+	for _, column := range historyLogColumns {
+		if _, ok := indexes[column]; !ok && !optionalHistoryLogColumns[column] {
+			return output, errors.New(fmt.Sprintf("missing column in CSV header: \"%s\"", column))
+		}
+	}
+
+	optionalValue := func(record []string, column string) string {
+		if index, ok := indexes[column]; ok && index < len(record) {
+			return record[index]
+		}
+		return ""
+	}
+
+	for _, record := range records[1:] {
+		output = append(output, HistoryLogEntry{
+			OperationId:   record[indexes["operation_id"]],
+			Timestamp:     record[indexes["timestamp"]],
+			User:          record[indexes["user"]],
+			Host:          record[indexes["host"]],
+			Cwd:           record[indexes["cwd"]],
+			Source:        record[indexes["source"]],
+			Destination:   record[indexes["destination"]],
+			Kind:          record[indexes["kind"]],
+			PreviousValue: optionalValue(record, "previous_value"),
+			Value:         optionalValue(record, "value"),
+		})
+	}
+
+	return output, nil
+}
+
+func historyItemExists(item HistoryItem) (bool, error) {
+	var count int
+	err := profileDb_.QueryRow("SELECT count(*) FROM history WHERE IFNULL(operation_id, '') = ? AND source = ? AND destination = ? AND timestamp = ? AND IFNULL(kind, 1) = ?", item.OperationId, item.Source, item.Dest, item.Timestamp, item.Kind).Scan(&count)
+	return count > 0, err
+}
+
+func handleHistoryExportCommand(opts *CommandLineOptions, args []string) error {
+	format, err := historyLogFormat(opts.HistoryExport)
+	if err != nil {
+		return err
+	}
+
+	items, err := allHistoryItems()
+	if err != nil {
+		return err
+	}
+
+	var entries []HistoryLogEntry
+	for _, item := range items {
+		entries = append(entries, historyItemToLogEntry(item))
+	}
+
+	f, err := os.Create(opts.HistoryExport)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = writeHistoryLog(f, format, entries)
+	if err != nil {
+		return err
+	}
+
+	logInfo("Exported %d history item(s) to \"%s\"", len(entries), opts.HistoryExport)
+	return nil
+}
+
+func handleHistoryImportCommand(opts *CommandLineOptions, args []string) error {
+	format, err := historyLogFormat(opts.HistoryImport)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(opts.HistoryImport)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := readHistoryLog(f, format)
+	if err != nil {
+		return err
+	}
+
+	var items []HistoryItem
+	existingCount := 0
+
+	for i, entry := range entries {
+		item, err := historyLogEntryToItem(entry)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid history item #%d: %s", i+1, err))
+		}
+		item.Imported = true
+
+		exists, err := historyItemExists(item)
+		if err != nil {
+			return err
+		}
+		if exists {
+			existingCount++
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	if !opts.DryRun {
+		err = insertHistoryItems(items)
+		if err != nil {
+			return err
+		}
+	}
+
+	logInfo("Imported %d history item(s) from \"%s\"", len(items), opts.HistoryImport)
+	if existingCount > 0 {
+		logInfo("Skipped %d item(s) already in history", existingCount)
+	}
+
+	return nil
+}
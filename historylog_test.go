@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_writeReadHistoryLog(t *testing.T) {
+	entries := []HistoryLogEntry{
+		{
+			OperationId: "abcd",
+			Timestamp:   "2015-06-10T14:30:00Z",
+			User:        "laurent",
+			Host:        "localhost",
+			Cwd:         "/home/laurent",
+			Source:      "/home/laurent/one",
+			Destination: "/home/laurent/two, \"three\"",
+			Kind:        "rename",
+		},
+	}
+
+	for _, format := range []string{"csv", "json"} {
+		var buffer bytes.Buffer
+		err := writeHistoryLog(&buffer, format, entries)
+		if err != nil {
+			t.Fatalf("%s: Expected no error, got %s", format, err)
+		}
+
+		r, err := readHistoryLog(&buffer, format)
+		if err != nil {
+			t.Fatalf("%s: Expected no error, got %s", format, err)
+		}
+
+		if len(r) != 1 {
+			t.Fatalf("%s: Expected 1 entry, got %d", format, len(r))
+		}
+
+		if r[0] != entries[0] {
+			t.Errorf("%s: Expected %v, got %v", format, entries[0], r[0])
+		}
+	}
+
+	_, err := readHistoryLog(bytes.NewBufferString("source,destination\na,b\n"), "csv")
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func Test_historyLogFormat(t *testing.T) {
+	if f, _ := historyLogFormat("history.CSV"); f != "csv" {
+		t.Errorf("Expected csv, got %s", f)
+	}
+
+	if f, _ := historyLogFormat("/path/to/history.json"); f != "json" {
+		t.Errorf("Expected json, got %s", f)
+	}
+
+	if _, err := historyLogFormat("history.txt"); err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func Test_handleHistoryExportImportCommand(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	var fileActions []*FileAction
+
+	fileAction := NewFileAction()
+	fileAction.oldPath = "one"
+	fileAction.newPath = "1"
+	fileActions = append(fileActions, fileAction)
+
+	fileAction = NewFileAction()
+	fileAction.oldPath = "two"
+	fileAction.newPath = "2"
+	fileActions = append(fileActions, fileAction)
+
+	saveHistoryItems(fileActions)
+	profileDb_.Exec("INSERT INTO history (source, destination, timestamp, kind) VALUES (?, ?, ?, ?)", "a", "b", time.Now().Unix()-HISTORY_MAX_AGE-60, KIND_RENAME)
+
+	for _, ext := range []string{"csv", "json"} {
+		exportPath := filepath.Join(tempFolder(), "history."+ext)
+
+		opts := CommandLineOptions{
+			HistoryExport: exportPath,
+		}
+		err := handleHistoryExportCommand(&opts, []string{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		originalItems, _ := allHistoryItems()
+		clearHistory()
+
+		opts = CommandLineOptions{
+			HistoryImport: exportPath,
+		}
+		err = handleHistoryImportCommand(&opts, []string{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		// The item older than HISTORY_MAX_AGE is imported too, and kept
+		// when the old items are deleted.
+		deleteOldHistoryItems(time.Now().Unix() - HISTORY_MAX_AGE)
+
+		items, _ := allHistoryItems()
+		if len(items) != 3 {
+			t.Fatalf("%s: Expected 3 items, got %d", ext, len(items))
+		}
+
+		for i, item := range items {
+			o := originalItems[i]
+			if item.Source != o.Source || item.Dest != o.Dest || item.Timestamp != o.Timestamp || item.OperationId != o.OperationId || item.User != o.User || item.Host != o.Host || item.Cwd != o.Cwd || item.Kind != o.Kind {
+				t.Errorf("%s: Expected %v, got %v", ext, o, item)
+			}
+		}
+
+		// Importing the same file twice should not duplicate the items
+		handleHistoryImportCommand(&opts, []string{})
+		items, _ = allHistoryItems()
+		if len(items) != 3 {
+			t.Errorf("%s: Expected 3 items, got %d", ext, len(items))
+		}
+	}
+}
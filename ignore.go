@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the files whose patterns are honoured when the ignore files are
+// enabled. Their syntax is the same as .gitignore.
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+type ignoreRule struct {
+	dir      string // Directory of the ignore file. Patterns are relative to it.
+	pattern  string
+	negate   bool // "!pattern": the files are not ignored
+	dirOnly  bool // "pattern/": only directories match
+	anchored bool // The pattern contains a slash so it is matched against the relative path, not the name
+}
+
+func parseIgnoreRule(dir string, line string) (ignoreRule, bool) {
+	rule := ignoreRule{dir: dir}
+
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " ")
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return rule, false
+	}
+
+	rule.pattern = line
+	return rule, true
+}
+
+func (this ignoreRule) matches(path string, isDir bool) bool {
+	if this.dirOnly && !isDir {
+		return false
+	}
+
+	rel, err := filepath.Rel(this.dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	if this.anchored {
+		return matchPathPattern(this.pattern, rel)
+	}
+	return matchPathPattern(this.pattern, filepath.Base(rel))
+}
+
+// Tells which files are ignored according to the .gitignore and .ignore
+// files of their directory and its parents, up to the root of the Git
+// repository if there is one, or else up to the base directory.
+type ignoreMatcher struct {
+	baseDir string // Usually the current directory
+	rules   map[string][]ignoreRule
+}
+
+func newIgnoreMatcher(baseDir string) *ignoreMatcher {
+	return &ignoreMatcher{
+		baseDir: normalizePath(baseDir),
+		rules:   make(map[string][]ignoreRule),
+	}
+}
+
+func (this *ignoreMatcher) dirRules(dir string) []ignoreRule {
+	if rules, ok := this.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []ignoreRule
+	for _, name := range ignoreFileNames {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(dir, scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		f.Close()
+	}
+
+	this.rules[dir] = rules
+	return rules
+}
+
+// Returns the directories whose ignore files apply to the path, from the
+// top-most one. If the path is not in a Git repository, the directories
+// above the base directory are not included, so that eg. the ignore files
+// of the home directory are not used. A path outside of the base directory
+// only uses the ignore files of its own directory.
+func ignoreDirs(path string, baseDir string) []string {
+	var output []string
+	dir := filepath.Dir(path)
+	for {
+		output = append([]string{dir}, output...)
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return output
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	top := baseDir
+	if !pathIsUnder(path, baseDir) {
+		top = filepath.Dir(path)
+	}
+
+	var temp []string
+	for _, dir := range output {
+		if dir == top || pathIsUnder(dir, top) {
+			temp = append(temp, dir)
+		}
+	}
+	return temp
+}
+
+func (this *ignoreMatcher) isIgnored(path string) bool {
+	path = normalizePath(path)
+	dirs := ignoreDirs(path, this.baseDir)
+
+	// A file inside an ignored directory is ignored too, so the directories
+	// between the top-most one and the file are checked first.
+	var candidates []string
+	for _, dir := range dirs[1:] {
+		candidates = append(candidates, dir)
+	}
+	candidates = append(candidates, path)
+
+	for _, candidate := range candidates {
+		if filepath.Base(candidate) == ".git" {
+			return true
+		}
+
+		isDir := candidate != path
+		if !isDir {
+			if info, err := os.Stat(path); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+
+		ignored := false
+		for _, dir := range dirs {
+			if dir != filepath.Dir(candidate) && !pathIsUnder(filepath.Dir(candidate), dir) {
+				continue
+			}
+			for _, rule := range this.dirRules(dir) {
+				if rule.matches(candidate, isDir) {
+					ignored = !rule.negate
+				}
+			}
+		}
+
+		if ignored {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ignoreMatcher(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	root := filepath.Join(tempFolder(), "repo")
+	os.MkdirAll(filepath.Join(root, ".git"), 0700)
+	os.MkdirAll(filepath.Join(root, "src", "generated"), 0700)
+	os.MkdirAll(filepath.Join(root, "dist"), 0700)
+
+	// Ignore files outside of the repository are not used
+	ioutil.WriteFile(filepath.Join(tempFolder(), ".gitignore"), []byte("*.go\n"), 0700)
+	ioutil.WriteFile(filepath.Join(root, ".gitignore"), []byte("# Comment\n*.log\n!keep.log\n/dist/\ngenerated/\n"), 0700)
+	ioutil.WriteFile(filepath.Join(root, "src", ".ignore"), []byte("*.tmp\n"), 0700)
+
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"main.go", false},
+		{"error.log", true},
+		{"keep.log", false},
+		{"src/error.log", true},
+		{"dist", true},
+		{"dist/app.js", true},
+		{"src/dist", false},
+		{"src/generated/a.go", true},
+		{"src/a.tmp", true},
+		{"a.tmp", false},
+		{".git", true},
+	}
+
+	matcher := newIgnoreMatcher(tempFolder())
+	for _, testCase := range testCases {
+		path := filepath.Join(root, filepath.FromSlash(testCase.path))
+		actual := matcher.isIgnored(path)
+		if actual != testCase.expected {
+			t.Errorf("\"%s\": expected %t, got %t", testCase.path, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_ignoreMatcher_noRepository(t *testing.T) {
+	// The test folder might be inside a Git repository
+	dir, err := ioutil.TempDir("", "massren")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "base")
+	os.MkdirAll(filepath.Join(base, "sub"), 0700)
+	other := filepath.Join(dir, "other")
+	os.MkdirAll(other, 0700)
+
+	for parent := dir; parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+		if _, err := os.Lstat(filepath.Join(parent, ".git")); err == nil {
+			t.Skipf("\"%s\" is inside a Git repository", dir)
+		}
+	}
+
+	// The ignore file above the base directory, eg. in the home directory,
+	// is not used.
+	ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.jpg\n"), 0700)
+	ioutil.WriteFile(filepath.Join(base, ".gitignore"), []byte("*.log\n"), 0700)
+	ioutil.WriteFile(filepath.Join(other, ".ignore"), []byte("*.tmp\n"), 0700)
+
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{filepath.Join(base, "a.jpg"), false},
+		{filepath.Join(base, "sub", "a.jpg"), false},
+		{filepath.Join(base, "sub", "a.log"), true},
+		{filepath.Join(other, "a.jpg"), false},
+		{filepath.Join(other, "a.tmp"), true},
+	}
+
+	matcher := newIgnoreMatcher(base)
+	for _, testCase := range testCases {
+		actual := matcher.isIgnored(testCase.path)
+		if actual != testCase.expected {
+			t.Errorf("\"%s\": expected %t, got %t", testCase.path, testCase.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// In live mode, the renames are applied every time the file list is saved,
+// and the file list is then rewritten with the new names, until the editor
+// is closed. All the changes are recorded as one operation in the history.
+type liveSession struct {
+	listFilePath  string
+	filePaths     []string
+	listOptions   ListFileOptions
+	actionOptions FileActionOptions
+	dryRun        bool
+	operation     *historyOperation
+	state         fileState // State of the file list when it was last processed
+}
+
+// Returns the path of the file once the actions have been done, in the
+// order they have been done. The second value is false if the file has
+// been deleted.
+func pathAfterActions(path string, doneActions []*FileAction) (string, bool) {
+	path = normalizePath(path)
+	for _, action := range doneActions {
+		oldPath := action.FullOldPath()
+		if action.kind == KIND_DELETE {
+			if path == oldPath || pathIsUnder(path, oldPath) {
+				return path, false
+			}
+			continue
+		}
+
+		if action.kind != KIND_RENAME {
+			continue
+		}
+
+		if path == oldPath {
+			path = action.FullNewPath()
+		} else {
+			path, _ = replacePathPrefix(path, oldPath, action.FullNewPath())
+		}
+	}
+	return path, true
+}
+
+func pathsAfterActions(paths []string, doneActions []*FileAction) []string {
+	var output []string
+	for _, path := range paths {
+		if newPath, ok := pathAfterActions(path, doneActions); ok {
+			output = append(output, newPath)
+		}
+	}
+	return output
+}
+
+func companionsAfterActions(companions map[string][]string, doneActions []*FileAction) map[string][]string {
+	if len(companions) == 0 {
+		return companions
+	}
+
+	output := make(map[string][]string)
+	for path, companionPaths := range companions {
+		if newPath, ok := pathAfterActions(path, doneActions); ok {
+			output[newPath] = pathsAfterActions(companionPaths, doneActions)
+		}
+	}
+	return output
+}
+
+// Applies the changes made to the file list since it was last processed.
+// Invalid changes are reported but do not end the session, so that the
+// file list can be fixed and saved again.
+func (this *liveSession) applyChanges() error {
+	content, err := ioutil.ReadFile(this.listFilePath)
+	if err != nil {
+		return err
+	}
+
+	this.state, err = readFileState(this.listFilePath)
+	if err != nil {
+		return err
+	}
+
+	actions, err := fileActionsWithOptions(this.filePaths, string(content), this.actionOptions)
+	if err != nil {
+		logError("%s", err)
+		logInfo("No file has been renamed. Please fix the file list and save it again.")
+		return nil
+	}
+
+	if len(actions) == 0 {
+		return nil
+	}
+
+	doneActions, err := processOperationFileActions(actions, this.dryRun, this.operation)
+	if err != nil {
+		logError("%s", err)
+	}
+
+	if this.dryRun {
+		return nil
+	}
+
+	this.filePaths = pathsAfterActions(this.filePaths, doneActions)
+	this.actionOptions.Companions = companionsAfterActions(this.actionOptions.Companions, doneActions)
+	this.listOptions.Companions = this.actionOptions.Companions
+
+	logInfo("%d file(s) renamed or deleted. The file list has been updated.", len(doneActions))
+
+	// The file list is written back with the line endings used by the
+	// editor, so that it is not reloaded with different ones.
+	listFileContent := createListFileContentWithOptions(this.filePaths, this.listOptions)
+	listFileContent = withNewline(listFileContent, detectNewline(decodeBuffer(string(content))))
+
+	err = ioutil.WriteFile(this.listFilePath, []byte(listFileContent), PROFILE_PERM)
+	if err != nil {
+		return err
+	}
+
+	this.state, err = readFileState(this.listFilePath)
+	return err
+}
+
+// Opens the editor and applies the changes every time the file list is
+// saved, until the editor is closed.
+func (this *liveSession) run() error {
+	var err error
+
+	// The transforms are only applied to the initial file list
+	this.listOptions.Transform = nil
+	this.operation = newHistoryOperation()
+	this.state, err = readFileState(this.listFilePath)
+	if err != nil {
+		return err
+	}
+
+	editorStartTime := time.Now()
+	waitForCommand := make(chan error, 1)
+	go func() {
+		waitForCommand <- editFile(this.listFilePath)
+	}()
+
+	logInfo("Live mode: the files are renamed every time the file list is saved. Close the editor to finish. (Press Ctrl + C to abort)")
+
+	var stopWatching chan bool
+	var waitForFileChange chan error
+
+	for {
+		if waitForFileChange == nil {
+			stopWatching = make(chan bool)
+			waitForFileChange = make(chan error, 1)
+			go func(state fileState, stop chan bool, done chan error) {
+				_, err := watchFileChanges(this.listFilePath, state, stop)
+				done <- err
+			}(this.state, stopWatching, waitForFileChange)
+		}
+
+		select {
+
+		case err := <-waitForFileChange:
+
+			waitForFileChange = nil
+			if err != nil {
+				return err
+			}
+
+			err = this.applyChanges()
+			if err != nil {
+				return err
+			}
+
+		case err := <-waitForCommand:
+
+			if err != nil {
+				close(stopWatching)
+				return err
+			}
+
+			changed, err := fileHasChanged(this.listFilePath, this.state)
+			if err != nil {
+				close(stopWatching)
+				return err
+			}
+
+			if !changed && editorRunsInBackground(time.Since(editorStartTime)) {
+				logInfo("The editor seems to run in the background. The files will be renamed every time the file list is saved until Ctrl + C is pressed.")
+				// Receiving from a nil channel blocks forever
+				waitForCommand = nil
+				continue
+			}
+
+			close(stopWatching)
+
+			// The file list might have been saved right before the editor
+			// was closed.
+			if changed {
+				err = this.applyChanges()
+			}
+
+			os.Remove(this.listFilePath)
+			return err
+
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func Test_pathAfterActions(t *testing.T) {
+	dir := normalizePath("/tmp/live")
+
+	var actions []*FileAction
+	for _, paths := range [][]string{
+		{filepath.Join(dir, "photos"), filepath.Join(dir, "pictures")},
+		{filepath.Join(dir, "pictures", "a.jpg"), filepath.Join(dir, "pictures", "b.jpg")},
+	} {
+		action := NewFileAction()
+		action.kind = KIND_RENAME
+		action.setFullPaths(paths[0], paths[1])
+		actions = append(actions, action)
+	}
+	deleteAction := NewFileAction()
+	deleteAction.kind = KIND_DELETE
+	deleteAction.oldPath = filepath.Join(dir, "trash")
+	actions = append(actions, deleteAction)
+
+	testCases := []struct {
+		path     string
+		expected string
+		exists   bool
+	}{
+		{filepath.Join(dir, "photos"), filepath.Join(dir, "pictures"), true},
+		{filepath.Join(dir, "photos", "a.jpg"), filepath.Join(dir, "pictures", "b.jpg"), true},
+		{filepath.Join(dir, "photos", "c.jpg"), filepath.Join(dir, "pictures", "c.jpg"), true},
+		{filepath.Join(dir, "other"), filepath.Join(dir, "other"), true},
+		{filepath.Join(dir, "trash", "d.jpg"), "", false},
+	}
+
+	for _, testCase := range testCases {
+		actual, exists := pathAfterActions(testCase.path, actions)
+		if exists != testCase.exists || (exists && actual != testCase.expected) {
+			t.Errorf("\"%s\": expected \"%s\" (%t), got \"%s\" (%t)", testCase.path, testCase.expected, testCase.exists, actual, exists)
+		}
+	}
+}
+
+func Test_liveSession_applyChanges(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	a := filepath.Join(tempFolder(), "a")
+	b := filepath.Join(tempFolder(), "b")
+	touch(a)
+	touch(b)
+
+	listFilePath := filepath.Join(tempFolder(), "list.txt")
+	ioutil.WriteFile(listFilePath, []byte("a\nb\n"), 0700)
+
+	session := liveSession{
+		listFilePath: listFilePath,
+		filePaths:    []string{a, b},
+		operation:    newHistoryOperation(),
+	}
+
+	ioutil.WriteFile(listFilePath, []byte("c\nb\n"), 0700)
+	err := session.applyChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fileExists(filepath.Join(tempFolder(), "c")) || fileExists(a) {
+		t.Fatal("File has not been renamed")
+	}
+
+	if fileGetContent(listFilePath) != "c\nb\n" {
+		t.Errorf("File list has not been rewritten: %s", fileGetContent(listFilePath))
+	}
+
+	// An invalid change is ignored and does not end the session
+	ioutil.WriteFile(listFilePath, []byte("c\n"), 0700)
+	err = session.applyChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(listFilePath, []byte("a\nd\n"), 0700)
+	err = session.applyChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fileExists(a) || !fileExists(filepath.Join(tempFolder(), "d")) {
+		t.Fatal("Files have not been renamed")
+	}
+
+	if fileGetContent(listFilePath) != "a\nd\n" {
+		t.Errorf("File list has not been rewritten: %s", fileGetContent(listFilePath))
+	}
+
+	items, _ := allHistoryItems()
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 history items, got %d", len(items))
+	}
+
+	for _, item := range items {
+		if item.OperationId != session.operation.id || item.Timestamp != session.operation.timestamp {
+			t.Error("All the changes should be part of the same operation")
+		}
+	}
+}
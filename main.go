@@ -24,20 +24,52 @@ import (
 
 var flagParser_ *flags.Parser
 var newline_ string
+var stdinConsumed_ bool // The file paths have been read from stdin so it cannot be used by the editor
 
 const (
 	APPNAME     = "massren"
 	LINE_LENGTH = 80
 	KIND_RENAME = 1
 	KIND_DELETE = 2
+	KIND_TOUCH  = 3 // Change of modification time (see attribute.go)
+	KIND_CHMOD  = 4 // Change of mode
 )
 
 type CommandLineOptions struct {
-	DryRun  bool `short:"n" long:"dry-run" description:"Don't rename anything but show the operation that would have been performed."`
-	Verbose bool `short:"v" long:"verbose" description:"Enable verbose output."`
-	Config  bool `short:"c" long:"config" description:"Set or list configuration values. For more info, type: massren --config --help"`
-	Undo    bool `short:"u" long:"undo" description:"Undo a rename operation. Currently delete operations cannot be undone (though files can be recovered from the trash in OSX and Windows). eg. massren --undo [path]"`
-	Version bool `short:"V" long:"version" description:"Displays version information."`
+	DryRun  bool   `short:"n" long:"dry-run" description:"Don't rename anything but show the operation that would have been performed."`
+	Verbose bool   `short:"v" long:"verbose" description:"Enable verbose output."`
+	Config  bool   `short:"c" long:"config" description:"Set or list configuration values. For more info, type: massren --config --help"`
+	Undo    bool   `short:"u" long:"undo" description:"Undo a rename operation. Currently delete operations cannot be undone (though files can be recovered from the trash in OSX and Windows). eg. massren --undo [path]"`
+	Under   string `long:"under" description:"With --undo, undo all the rename operations whose destination is inside the given directory. eg. massren --undo --under ~/Photos"`
+	Since   string `long:"since" description:"With --undo, undo all the rename operations done since the given time. eg. massren --undo --since today"`
+	Version bool   `short:"V" long:"version" description:"Displays version information."`
+
+	Sanitize         bool   `long:"sanitize" description:"Rewrite the new filenames that are not valid for the configured filename profile instead of cancelling the operation. For more info, type: massren --config --help"`
+	NormalizeUnicode string `long:"normalize-unicode" description:"Rename the files to their NFC or NFD normalized names, without opening the editor. eg. massren --normalize-unicode NFC *"`
+	OnCollision      string `long:"on-collision" description:"What to do when a new name is already used by another file: abort, number or skip. Overrides the collision_policy config value."`
+
+	Transform          []string `short:"t" long:"transform" description:"Pre-fill the file buffer with the filenames changed by a built-in transform. Can be specified multiple times. Possible values: ascii, slugify, lower, upper, title, collapse-spaces, separator:<separator>. eg. massren -t ascii -t separator:_"`
+	TransformExtension bool     `long:"transform-extension" description:"Also apply the transforms to the file extensions, which are preserved by default."`
+	NoEdit             bool     `long:"no-edit" description:"With --transform, rename the files directly without opening the editor."`
+	Tui                bool     `long:"tui" description:"Use the built-in terminal editor instead of an external text editor. It is used by default when no text editor can be found."`
+	Live               bool     `short:"l" long:"live" description:"Rename the files every time the file list is saved, and update the list with the new names, until the editor is closed."`
+
+	LockExtensions bool     `short:"x" long:"lock-extensions" description:"Show the file extensions separately in the file buffer so that they are not changed by mistake. Same as the lock_extensions config value."`
+	Null           bool     `short:"0" long:"null" description:"The file paths read from stdin are separated by NUL characters instead of newlines. eg. find . -print0 | massren -0 -"`
+	Exclude        []string `short:"e" long:"exclude" description:"Leave out the files matching the pattern. Can be specified multiple times. eg. massren -e node_modules -e \"*.tmp\""`
+	NoHidden       bool     `long:"no-hidden" description:"Leave out the hidden files, whose name starts with a dot."`
+	UseIgnoreFiles bool     `long:"use-ignore-files" description:"Leave out the files ignored by .gitignore and .ignore files."`
+	Sort           string   `long:"sort" description:"Order of the files in the file buffer: name, natural, mtime, ctime, size or ext. Overrides the sort config value. Default: name."`
+	Reverse        bool     `short:"r" long:"reverse" description:"Reverse the order of the files in the file buffer."`
+	Companions     string   `long:"companions" description:"Groups of extensions of the companion files that are renamed and deleted along with the main files. Overrides the companion_files config value. eg. massren --companions \"cr2,jpg:xmp;mp4:srt\""`
+	Annotate       string   `long:"annotate" description:"Comma-separated list of the information shown after each filename in the file buffer: size, mtime, dimensions or duration. Overrides the annotations config value. eg. massren --annotate size,dimensions *.png"`
+	Attributes     string   `long:"attributes" description:"Comma-separated list of the file attributes shown after each filename in the file buffer, which are changed when they are edited: mtime or mode. Overrides the attributes config value. eg. massren --attributes mtime,mode"`
+	Confirm        bool     `long:"confirm" description:"Show the changes once the editor is closed and ask whether to apply them, cancel them or edit the file list again. Same as the confirm config value."`
+	Yes            bool     `short:"y" long:"yes" description:"Apply the changes without asking for confirmation, even if the confirm config value is set."`
+	BufferFormat   string   `long:"buffer-format" description:"Format of the file buffer: names (one new name per line, in the original order) or pairs (\"original => new\" lines, which can be reordered). Overrides the buffer_format config value."`
+
+	HistoryExport string `long:"history-export" description:"Export the history of rename operations to a CSV or JSON file, depending on the file extension. eg. massren --history-export history.csv"`
+	HistoryImport string `long:"history-import" description:"Import a history file created by --history-export, so that the operations can be undone on this computer. eg. massren --history-import history.json"`
 }
 
 type FileAction struct {
@@ -45,6 +77,52 @@ type FileAction struct {
 	newPath          string
 	intermediatePath string
 	kind             int
+	line             int // Line number in the file buffer
+
+	// New and previous values of the attribute changed by a KIND_TOUCH or
+	// KIND_CHMOD action. The previous values are set once the attribute has
+	// been changed.
+	mtime         time.Time
+	mode          os.FileMode
+	previousMtime time.Time
+	previousMode  os.FileMode
+}
+
+type FilePathOptions struct {
+	IncludeDirectories bool
+	IncludeHidden      bool      // Include the files whose name starts with a dot
+	Excludes           []string  // Patterns of the files to leave out (see isExcluded())
+	UseIgnoreFiles     bool      // Leave out the files ignored by .gitignore and .ignore files
+	Stdin              io.Reader // Where the file paths are read from when "-" is one of the arguments
+	NullSeparated      bool      // The file paths read from Stdin are separated by NUL characters
+}
+
+type ListFileOptions struct {
+	IncludeHeader  bool
+	Transform      filenameTransform   // Transform applied to the filenames before they are written to the buffer
+	LockExtensions bool                // Write the extensions in a trailing comment instead of as part of the names
+	Companions     map[string][]string // Companion files of each file, shown as comments if ShowCompanions is true
+	ShowCompanions bool
+	TwoColumns     bool          // Write each line as "original => new" (see pairFileActions())
+	HeaderTemplate string        // Empty for DEFAULT_HEADER_TEMPLATE
+	Markers        BufferMarkers // Comment and delete markers
+	Annotations    []string      // Names of the annotations shown after each file (see annotationExtractors_)
+	Attributes     []string      // Names of the editable attributes shown after each file: "mtime" and "mode"
+}
+
+type FileActionOptions struct {
+	FilenameProfile      string              // Name of the filename profile new names are validated against. Empty for no validation.
+	Sanitize             bool                // Rewrite the invalid names instead of returning an error
+	UnicodeNormalization string              // "NFC" or "NFD" to normalize the new names. Empty or "none" to keep them as they are.
+	CollisionPolicy      string              // What to do when a new name is already used: "abort" (default), "number" or "skip"
+	CollisionFormat      string              // Format of the numbered names. Empty for DEFAULT_COLLISION_FORMAT.
+	LockExtensions       bool                // The buffer was created with ListFileOptions.LockExtensions
+	TwoColumns           bool                // The buffer was created with ListFileOptions.TwoColumns
+	Markers              BufferMarkers       // Comment and delete markers the buffer was created with
+	Annotations          bool                // The buffer was created with ListFileOptions.Annotations
+	Attributes           bool                // The buffer was created with ListFileOptions.Attributes
+	Companions           map[string][]string // Companion files of each file, which follow the changes made to it
+	SkipConflictChecks   bool                // Don't check that the new names are free (see fileActionConflicts())
 }
 
 type DeleteOperationsFirst []*FileAction
@@ -67,6 +145,23 @@ func (this *FileAction) FullNewPath() string {
 	return normalizePath(filepath.Join(filepath.Dir(this.oldPath), filepath.Dir(this.newPath), filepath.Base(this.newPath)))
 }
 
+// Sets the old and new paths from the full paths, keeping the new path
+// relative to the old one.
+func (this *FileAction) setFullPaths(oldPath string, newPath string) {
+	if oldPath == this.FullOldPath() && newPath == this.FullNewPath() {
+		return
+	}
+
+	relPath, err := filepath.Rel(filepath.Dir(oldPath), newPath)
+	if err != nil {
+		// Eg. paths on different volumes on Windows
+		return
+	}
+
+	this.oldPath = oldPath
+	this.newPath = relPath
+}
+
 func (this *FileAction) String() string {
 	return fmt.Sprintf("Kind: %d; Old: \"%s\"; New: \"%s\"", this.kind, this.oldPath, this.newPath)
 }
@@ -92,24 +187,82 @@ func criticalError(err error) {
 	os.Exit(1)
 }
 
+// Waits for the content of the file to be changed.
 func watchFile(filePath string) error {
-	initialStat, err := os.Stat(filePath)
+	initial, err := readFileState(filePath)
 	if err != nil {
 		return err
 	}
 
-	for {
-		stat, err := os.Stat(filePath)
+	_, err = watchFileChanges(filePath, initial, nil)
+	return err
+}
+
+// Opens the file list in the editor and waits for the editor to exit, or
+// for the file list to be saved if the editor runs in the background (see
+// editorRunsInBackground()).
+// Returns whether the file list has been changed.
+func editListFile(listFilePath string) (bool, error) {
+	initialState, err := readFileState(listFilePath)
+	if err != nil {
+		return false, err
+	}
+
+	waitForFileChange := make(chan error, 1)
+	waitForCommand := make(chan error, 1)
+	stopWatching := make(chan bool)
+
+	go func() {
+		logInfo("Waiting for file list to be saved... (Press Ctrl + C to abort)")
+		_, err := watchFileChanges(listFilePath, initialState, stopWatching)
+		waitForFileChange <- err
+	}()
+
+	editorStartTime := time.Now()
+	go func() {
+		waitForCommand <- editFile(listFilePath)
+	}()
+
+	select {
+
+	case err := <-waitForFileChange:
+
+		if err != nil {
+			return false, err
+		}
+		logDebug("File list has been saved. Waiting for the editor to exit...")
+		err = <-waitForCommand
+		if err != nil {
+			return false, err
+		}
+
+	case err := <-waitForCommand:
+
 		if err != nil {
-			return err
+			close(stopWatching)
+			return false, err
+		}
+
+		changed, err := fileHasChanged(listFilePath, initialState)
+		if err != nil || changed {
+			close(stopWatching)
+			return changed, err
+		}
+
+		if !editorRunsInBackground(time.Since(editorStartTime)) {
+			close(stopWatching)
+			return false, nil
 		}
 
-		if stat.Size() != initialStat.Size() || stat.ModTime() != initialStat.ModTime() {
-			return nil
+		logInfo("The editor seems to run in the background. Waiting for the file list to be saved...")
+		err = <-waitForFileChange
+		if err != nil {
+			return false, err
 		}
 
-		time.Sleep(1 * time.Second)
 	}
+
+	return fileHasChanged(listFilePath, initialState)
 }
 
 func newline() string {
@@ -253,6 +406,15 @@ func editFile(filePath string) error {
 	cmd := exec.Command(commandString, args[0:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
+
+	if stdinConsumed_ {
+		terminal, err := openTerminal()
+		if err != nil {
+			return errors.New(fmt.Sprintf("the file paths have been read from stdin, but the terminal could not be opened for the editor: %s", err))
+		}
+		defer terminal.Close()
+		cmd.Stdin = terminal
+	}
 	err = cmd.Run()
 
 	if err != nil {
@@ -261,31 +423,217 @@ func editFile(filePath string) error {
 	return nil
 }
 
+// Returns the controlling terminal, which the editor reads from when stdin
+// has been used for the file paths.
+func openTerminal() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.OpenFile("CONIN$", os.O_RDWR, 0)
+	}
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// Reads the file paths separated by newlines or NUL characters, as output
+// by `find` or `find -print0`. Empty lines and duplicates are ignored, and
+// an error is returned if some of the files don't exist.
+func readFilePaths(reader io.Reader, nullSeparated bool) ([]string, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return []string{}, err
+	}
+
+	separator := "\n"
+	if nullSeparated {
+		separator = "\x00"
+	}
+
+	var output []string
+	var missing []string
+	done := make(map[string]bool)
+
+	for _, path := range strings.Split(string(content), separator) {
+		if !nullSeparated {
+			path = strings.TrimRight(path, "\r")
+		}
+		if path == "" || done[normalizePath(path)] {
+			continue
+		}
+		done[normalizePath(path)] = true
+
+		if _, err := os.Lstat(path); err != nil {
+			missing = append(missing, path)
+			continue
+		}
+
+		// The names are written one per line in the file list, so a name
+		// with a line break cannot be matched with its line.
+		if strings.ContainsAny(filepath.Base(path), "\r\n") {
+			return []string{}, errors.New(fmt.Sprintf("cannot rename %q: file names that contain line breaks are not supported", path))
+		}
+
+		output = append(output, path)
+	}
+
+	if len(missing) > 0 {
+		return output, errors.New(fmt.Sprintf("some of the files read from stdin do not exist:\n%s", strings.Join(missing, "\n")))
+	}
+
+	return output, nil
+}
+
 func filePathsFromArgs(args []string, includeDirectories bool) ([]string, error) {
+	return filePathsFromArgsWithOptions(args, FilePathOptions{IncludeDirectories: includeDirectories, IncludeHidden: true})
+}
+
+// Tells whether the path matches one of the exclude patterns. Patterns
+// without a slash are matched against the name, the other ones against the
+// end of the path. eg. "build/*.o" matches "project/build/main.o".
+func isExcluded(path string, patterns []string) bool {
+	components := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	for _, pattern := range patterns {
+		pattern = strings.TrimRight(filepath.ToSlash(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+
+		if !strings.Contains(pattern, "/") {
+			if matchPathPattern(pattern, components[len(components)-1]) {
+				return true
+			}
+			continue
+		}
+
+		if strings.HasPrefix(pattern, "/") {
+			if matchPathPattern(pattern, filepath.ToSlash(normalizePath(path))) {
+				return true
+			}
+			continue
+		}
+
+		for i := range components {
+			if matchPathPattern(pattern, strings.Join(components[i:], "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isHiddenFile(path string) bool {
+	name := filepath.Base(path)
+	return len(name) > 1 && name[0] == '.' && name != ".."
+}
+
+// Splits a comma-separated list of patterns, as found in the config.
+func splitPatternList(s string) []string {
+	var output []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" {
+			output = append(output, pattern)
+		}
+	}
+	return output
+}
+
+func filePathsFromArgsWithOptions(args []string, options FilePathOptions) ([]string, error) {
+	includeDirectories := options.IncludeDirectories
 	var output []string
 	var err error
 
-	if len(args) == 0 || args[0] == "." {
-		output, err = filepath.Glob("*")
+	// Negated patterns only remove files, so if there are only negated
+	// patterns they apply to the current directory. The paths read from
+	// stdin are used as is.
+	var patterns []string
+	var negatedPatterns []string
+	var literalPaths []string
+	for _, arg := range args {
+		if arg == "-" {
+			if options.Stdin == nil {
+				return []string{}, errors.New("cannot read the file paths from stdin")
+			}
+			paths, err := readFilePaths(options.Stdin, options.NullSeparated)
+			if err != nil {
+				return []string{}, err
+			}
+			if options.Stdin == os.Stdin {
+				stdinConsumed_ = true
+			}
+			literalPaths = append(literalPaths, paths...)
+			continue
+		}
+
+		// An existing file whose name starts with "!" is used as is.
+		if _, statErr := os.Lstat(arg); statErr != nil && len(arg) > 1 && arg[0] == '!' {
+			negatedPatterns = append(negatedPatterns, arg[1:])
+		} else {
+			patterns = append(patterns, arg)
+		}
+	}
+
+	if (len(patterns) == 0 && len(literalPaths) == 0) || (len(patterns) > 0 && patterns[0] == ".") {
+		output, err = globPaths("*")
 		if err != nil {
 			return []string{}, err
 		}
 	} else {
-		for _, arg := range args {
-			if strings.Index(arg, "*") < 0 && strings.Index(arg, "?") < 0 {
-				output = append(output, arg)
-				continue
-			}
-			matches, err := filepath.Glob(arg)
-			if err != nil {
-				return []string{}, err
+		// The files inside hidden or excluded directories are not returned
+		// either, though the directories themselves can be named in the
+		// pattern.
+		skipDir := func(path string) bool {
+			return (!options.IncludeHidden && isHiddenFile(path)) || isExcluded(path, options.Excludes)
+		}
+
+		done := make(map[string]bool)
+		for _, pattern := range patterns {
+			// A file whose name contains glob characters, such as "a[1].jpg",
+			// is used as is.
+			matches := []string{pattern}
+			if _, statErr := os.Lstat(pattern); statErr != nil && hasGlobChars(pattern) {
+				matches, err = globPathsWithSkipDir(pattern, skipDir)
+				if err != nil {
+					return []string{}, err
+				}
 			}
 			for _, match := range matches {
+				if done[match] {
+					continue
+				}
+				done[match] = true
 				output = append(output, match)
 			}
 		}
 	}
 
+	if len(literalPaths) > 0 {
+		done := make(map[string]bool)
+		for _, path := range output {
+			done[normalizePath(path)] = true
+		}
+		for _, path := range literalPaths {
+			if !done[normalizePath(path)] {
+				done[normalizePath(path)] = true
+				output = append(output, path)
+			}
+		}
+	}
+
+	if len(negatedPatterns) > 0 {
+		var temp []string
+		for _, path := range output {
+			negated := false
+			for _, pattern := range negatedPatterns {
+				if matchNegatedPattern(pattern, path) {
+					negated = true
+					break
+				}
+			}
+			if !negated {
+				temp = append(temp, path)
+			}
+		}
+		output = temp
+	}
+
 	if !includeDirectories {
 		var temp []string
 		for _, path := range output {
@@ -298,11 +646,47 @@ func filePathsFromArgs(args []string, includeDirectories bool) ([]string, error)
 		output = temp
 	}
 
+	var ignore *ignoreMatcher
+	if options.UseIgnoreFiles {
+		ignore = newIgnoreMatcher(".")
+	}
+
+	var temp []string
+	for _, path := range output {
+		if !options.IncludeHidden && isHiddenFile(path) {
+			continue
+		}
+		if isExcluded(path, options.Excludes) {
+			continue
+		}
+		if ignore != nil && ignore.isIgnored(path) {
+			continue
+		}
+		temp = append(temp, path)
+	}
+	output = temp
+
 	sort.Strings(output)
 
 	return output, nil
 }
 
+// Tells whether the changes must be confirmed before being applied.
+func confirmationRequested(opts *CommandLineOptions) bool {
+	return (opts.Confirm || config_.BoolD("confirm", false)) && !opts.Yes && !opts.DryRun
+}
+
+func filePathOptionsFromConfig(opts *CommandLineOptions) FilePathOptions {
+	return FilePathOptions{
+		IncludeDirectories: config_.BoolD("include_directories", true),
+		IncludeHidden:      config_.BoolD("include_hidden", true) && !opts.NoHidden,
+		Excludes:           append(splitPatternList(config_.String("exclude")), opts.Exclude...),
+		UseIgnoreFiles:     config_.BoolD("use_ignore_files", false) || opts.UseIgnoreFiles,
+		Stdin:              os.Stdin,
+		NullSeparated:      opts.Null,
+	}
+}
+
 func stripBom(s string) string {
 	if len(s) < 3 {
 		return s
@@ -315,12 +699,9 @@ func stripBom(s string) string {
 
 func filePathsFromString(content string) []string {
 	var output []string
-	lines := strings.Split(content, newline())
-	for i, line := range lines {
+	lines := bufferLines(decodeBuffer(content))
+	for _, line := range lines {
 		line := strings.Trim(line, "\n\r")
-		if i == 0 {
-			line = stripBom(line)
-		}
 		if line == "" {
 			continue
 		}
@@ -357,9 +738,46 @@ Examples:
   Process all the JPEGs in the specified directory:
   % APPNAME /path/to/photos/*.jpg
   
+  Process the JPEGs and PNGs in the current directory and its sub-directories,
+  except for the thumbnails (the patterns must be quoted so that the shell
+  does not expand them):
+  % APPNAME '**/*.{jpg,png}' '!**/thumbnails/*'
+
+  Process the files modified during the last day, as found by another program:
+  % find . -mtime -1 -print0 | APPNAME -0 -
+
+  List the photos from the oldest to the most recent:
+  % APPNAME --sort mtime /path/to/photos/*.jpg
+
+  Rename the MP3s to lowercase ASCII names separated by hyphens, without
+  opening the editor ("Café Déjà Vu (Live).mp3" => "cafe-deja-vu-live.mp3"):
+  % APPNAME --transform slugify --no-edit *.mp3
+
+  Show the size and dimensions of the scans next to their names:
+  % APPNAME --annotate size,dimensions scans/*.png
+
+  Fix the modification times and permissions of the files along with their
+  names:
+  % APPNAME --attributes mtime,mode
+
+  Rename the files every time the file list is saved, which is useful with
+  editors that do not wait for the file to be closed (the editor must reload
+  the file list after each save to show the new names):
+  % APPNAME --live
+
+  Review the changes before they are applied, and go back to the editor if
+  something is wrong:
+  % APPNAME --confirm *.jpg
+
   Undo the changes done by the previous operation:
   % APPNAME --undo /path/to/photos/*.jpg
 
+  Undo all the changes done today in the specified directory:
+  % APPNAME --undo --under /path/to/photos --since today
+
+  Export the history of rename operations:
+  % APPNAME --history-export history.csv
+
   Set VIM as the default text editor:
   % APPNAME --config editor vim
   
@@ -381,8 +799,17 @@ Config commands:
   
 Possible key/values:
 
-  editor:              The editor to use when editing the list of files.
-                       Default: auto-detected.
+  editor:              The editor to use when editing the list of files. Use
+                       "tui" for the built-in terminal editor. Default:
+                       auto-detected, or the built-in editor if no text
+                       editor can be found.
+
+  editor_background:   Whether the editor runs in the background (eg. a GUI
+                       editor started without its "wait" option). If the
+                       editor command returns within two seconds without
+                       saving the file list, the file list keeps being
+                       watched until it is saved or Ctrl + C is pressed.
+                       Possible values: 0 or 1. Default: 0.
 
   use_trash:           Whether files should be moved to the trash/recycle bin
                        after deletion. Possible values: 0 or 1. Default: 1.
@@ -392,6 +819,109 @@ Possible key/values:
                        
   include_header:      Whether to show the header in the file buffer. Possible
                        values: 0 or 1. Default: 1.
+
+  filename_profile:    The system the new filenames must be valid for. Use
+                       "windows" or "fat32" if the files are going to be
+                       copied to a Windows share or a USB stick. Possible
+                       values: posix, macos, windows or fat32. Default: the
+                       current system.
+
+  unicode_normalization: The Unicode normalization applied to the new
+                       filenames. Use NFC for Linux and Windows, NFD for
+                       files created on older versions of OSX. Possible
+                       values: none, NFC or NFD. Default: none.
+
+  collision_policy:    What to do when a new name is already used, either by
+                       an existing file or by another line of the buffer.
+                       "abort" cancels the operation, "number" adds a number
+                       to the name (eg. "beach (2).jpg") and "skip" leaves
+                       the file as it is. Possible values: abort, number or
+                       skip. Default: abort.
+
+  collision_format:    Format of the numbered names used by the "number"
+                       collision policy. {name} is the name without
+                       extension, {ext} the extension and {n} the number.
+                       Default: "{name} ({n}){ext}".
+
+  lock_extensions:     Whether to show the file extensions separately in the
+                       file buffer, so that they are kept when the names are
+                       changed. Possible values: 0 or 1. Default: 0.
+
+  sort:                Order of the files in the file buffer. "natural" sorts
+                       "file2" before "file10", "mtime" and "ctime" by date
+                       and "ext" by extension. Possible values: name,
+                       natural, mtime, ctime, size or ext. Default: name.
+
+  sort_reverse:        Whether to reverse the order of the files in the file
+                       buffer. Possible values: 0 or 1. Default: 0.
+
+  exclude:             Comma-separated list of patterns of the files to
+                       always leave out, in addition to --exclude. Patterns
+                       with a "/" are matched against the end of the path,
+                       the other ones against the name. Default: none.
+
+  include_hidden:      Whether to include the hidden files, whose name starts
+                       with a dot. Possible values: 0 or 1. Default: 1.
+
+  use_ignore_files:    Whether to leave out the files ignored by .gitignore
+                       and .ignore files. Possible values: 0 or 1. Default: 0.
+
+  companion_files:     Groups of extensions of the companion files (or
+                       "sidecar" files) that are renamed and deleted along
+                       with their main file. For example with "cr2,jpg:xmp",
+                       "IMG_1.xmp" and "IMG_1.CR2.xmp" are renamed when
+                       "IMG_1.CR2" is renamed. Groups are separated by ";".
+                       Default: none.
+
+  show_companions:     Whether to show the companion files as comments under
+                       their main file in the file buffer. Possible values: 0
+                       or 1. Default: 1.
+
+  confirm:             Whether to show the changes once the editor is closed,
+                       with the changed characters highlighted, and ask
+                       whether to apply them. Also applies to --no-edit and
+                       --normalize-unicode, and cannot be used with --live.
+                       Use --yes to skip the confirmation. Possible values:
+                       0 or 1. Default: 0.
+
+  annotations:         Comma-separated list of the information shown after
+                       each filename in the file buffer, which is ignored
+                       when the file is saved. The dimensions are shown for
+                       JPEG, PNG and GIF images, and the duration for WAV
+                       files and, if ffprobe is installed, other audio and
+                       video files. Possible values: size, mtime,
+                       dimensions and duration. Default: none.
+
+  attributes:          Comma-separated list of the file attributes shown after
+                       each filename in the file buffer. Editing them changes
+                       the modification time or the mode (eg. 0644) of the
+                       files, which can be undone. Possible values: mtime and
+                       mode. Default: none.
+
+  header_template:     Text of the header of the file buffer. The placeholders
+                       {count}, {directory}, {hints}, {comment}, {delete}
+                       and {appname} are replaced by the number of files,
+                       the directory that contains them, the default
+                       explanations, the markers and the application name.
+                       "\n" starts a new line. Default: "{hints}".
+
+  comment_marker:      What the comment lines of the file buffer start with.
+                       The unchanged name of a file that starts with it is
+                       not a comment. Default: "//".
+
+  delete_marker:       What to put before a filename to delete the file. A
+                       line that starts with it but is not followed by the
+                       original filename is a comment if it also starts with
+                       the comment marker, or a new name otherwise. Default:
+                       the comment marker.
+
+  buffer_format:       Format of the file buffer. With "names", each line is
+                       the new name of the file at the same position. With
+                       "pairs", each line is "original => new", so that both
+                       names can be seen and the lines can be reordered.
+                       Files with the same name are shown with their
+                       relative path on the left side.
+                       Possible values: names or pairs. Default: names.
   
 Examples:
 
@@ -400,6 +930,28 @@ Examples:
   
   Don't move files to trash:
   % APPNAME --config use_trash 0
+
+  Only allow filenames that are valid on Windows:
+  % APPNAME --config filename_profile windows
+
+  Never list the Git and npm directories:
+  % APPNAME --config exclude ".git,node_modules"
+
+  Rename the XMP sidecars along with the RAW photos and the subtitles along
+  with the videos:
+  % APPNAME --config companion_files "cr2,nef,dng:xmp;mp4,mkv:srt"
+
+  Show the original names next to the new ones in the file buffer:
+  % APPNAME --config buffer_format pairs
+
+  Use "#" for comments, "- " to delete files, and a shorter header:
+  % APPNAME --config comment_marker "#"
+  % APPNAME --config delete_marker "- "
+  % APPNAME --config header_template "Renaming {count} files in {directory}"
+
+  Number the files that end up with the same name, as "beach_2.jpg":
+  % APPNAME --config collision_policy number
+  % APPNAME --config collision_format "{name}_{n}{ext}"
 `
 	}
 
@@ -407,10 +959,82 @@ Examples:
 }
 
 func fileActions(originalFilePaths []string, changedContent string) ([]*FileAction, error) {
-	if len(originalFilePaths) == 0 {
-		return []*FileAction{}, nil
+	return fileActionsWithOptions(originalFilePaths, changedContent, FileActionOptions{})
+}
+
+// A rename action that cannot be done because its destination is already
+// used.
+type fileActionConflict struct {
+	action  *FileAction
+	message string
+}
+
+// Returns the rename actions that would overwrite an existing file, then
+// the ones that rename two files to the same name.
+func fileActionConflicts(actions []*FileAction) ([]fileActionConflict, error) {
+	var output []fileActionConflict
+
+	// Loop through the actions and check that rename operations don't
+	// overwrite existing files.
+	for _, action := range actions {
+		if action.kind != KIND_RENAME {
+			continue
+		}
+		if fileInfo1, err := os.Stat(action.FullNewPath()); err == nil {
+			// Destination exists. Now check if the destination is also going to be
+			// renamed to something else (in which case, there is no error). Also
+			// OK if existing destination is going to be deleted.
+			ok := false
+			for _, action2 := range actions {
+				if action2.kind == KIND_RENAME && action2.FullOldPath() == action.FullNewPath() {
+					ok = true
+					break
+				}
+				if action2.kind == KIND_DELETE && action2.FullOldPath() == action.FullNewPath() {
+					ok = true
+					break
+				}
+			}
+
+			// Also OK if new path and old path are in fact the same file (for example if
+			// "/path/to/abcd" is going to be renamed to "/path/to/ABCD" on a case
+			// insensitive file system).
+			fileInfo2, err := os.Stat(action.FullOldPath())
+			if err != nil {
+				return output, errors.New(fmt.Sprintf("cannot stat \"%s\"", action.FullOldPath()))
+			}
+			if os.SameFile(fileInfo1, fileInfo2) {
+				ok = true
+			}
+
+			if !ok {
+				output = append(output, fileActionConflict{action, fmt.Sprintf("\"%s\" cannot be renamed to \"%s\": destination already exists", action.FullOldPath(), action.FullNewPath())})
+			}
+		}
 	}
-	lines := strings.Split(changedContent, newline())
+
+	// Loop through the actions and check that no two files are being
+	// renamed to the same name.
+	duplicateMap := make(map[string]bool)
+	for _, action := range actions {
+		if action.kind != KIND_RENAME {
+			continue
+		}
+		if _, ok := duplicateMap[action.FullNewPath()]; ok {
+			output = append(output, fileActionConflict{action, fmt.Sprintf("two files are being renamed to the same name: \"%s\"", action.FullNewPath())})
+		} else {
+			duplicateMap[action.FullNewPath()] = true
+		}
+	}
+
+	return output, nil
+}
+
+// Parses a buffer in which the lines are in the same order as the
+// original files.
+func positionalFileActions(originalFilePaths []string, changedContent string, options FileActionOptions) ([]*FileAction, error) {
+	lines := bufferLines(decodeBuffer(changedContent))
+	headerLength := options.Markers.headerLength(lines)
 	fileIndex := 0
 
 	var actionKind int
@@ -419,26 +1043,35 @@ func fileActions(originalFilePaths []string, changedContent string) ([]*FileActi
 	for i, line := range lines {
 		line := strings.Trim(line, "\n\r")
 
-		if i == 0 {
-			line = stripBom(line)
-		}
-
-		if line == "" {
+		if line == "" || i < headerLength {
 			continue
 		}
 
 		oldBasePath := filepath.Base(originalFilePaths[fileIndex])
-		newBasePath := ""
-		if len(line) >= 2 && line[0:2] == "//" {
-			// Check if it is a comment or a file being deleted.
-			newBasePath = strings.Trim(line[2:], " \t")
-			if newBasePath != strings.Trim(oldBasePath, " \t") {
-				// This is not a file being deleted, it's
-				// just a regular comment.
-				continue
+		if options.Annotations {
+			line = stripAnnotationComment(line, options.Markers.commentMarker())
+		}
+		attributeValues := make(map[string]string)
+		if options.Attributes {
+			var err error
+			line, attributeValues, err = parseAttributeComment(line, options.Markers.commentMarker())
+			if err != nil {
+				return []*FileAction{}, errors.New(fmt.Sprintf("line %d: %s", i+1, err))
 			}
+		}
+		if options.LockExtensions {
+			line = unlockExtensionLine(line, oldBasePath, options.Markers.commentMarker())
+		}
+		newBasePath := ""
+		if deletedName, ok := options.Markers.deletedName(line); ok && deletedName == strings.Trim(oldBasePath, " \t") {
 			newBasePath = ""
 			actionKind = KIND_DELETE
+		} else if options.Markers.isComment(line) && line != oldBasePath {
+			// This is not a file being deleted, it's
+			// just a regular comment. A file whose name
+			// starts with the comment marker is not a
+			// comment when it is left unchanged.
+			continue
 		} else {
 			newBasePath = line
 			actionKind = KIND_RENAME
@@ -451,10 +1084,19 @@ func fileActions(originalFilePaths []string, changedContent string) ([]*FileActi
 			action.kind = actionKind
 			action.oldPath = originalFilePaths[fileIndex]
 			action.newPath = newBasePath
+			action.line = i + 1
 
 			output = append(output, action)
 		}
 
+		if actionKind == KIND_RENAME {
+			attributeActions, err := attributeFileActions(originalFilePaths[fileIndex], attributeValues, i+1)
+			if err != nil {
+				return []*FileAction{}, err
+			}
+			output = append(output, attributeActions...)
+		}
+
 		fileIndex++
 		if fileIndex >= len(originalFilePaths) {
 			break
@@ -466,60 +1108,78 @@ func fileActions(originalFilePaths []string, changedContent string) ([]*FileActi
 		return []*FileAction{}, errors.New("not all files had a match")
 	}
 
-	// Loop through the actions and check that rename operations don't
-	// overwrite existing files.
-	for _, action := range output {
-		if action.kind != KIND_RENAME {
-			continue
+	return output, nil
+}
+
+func fileActionsWithOptions(originalFilePaths []string, changedContent string, options FileActionOptions) ([]*FileAction, error) {
+	if len(originalFilePaths) == 0 {
+		return []*FileAction{}, nil
+	}
+
+	var output []*FileAction
+	var err error
+	if options.TwoColumns {
+		output, err = pairFileActions(originalFilePaths, changedContent, options)
+	} else {
+		output, err = positionalFileActions(originalFilePaths, changedContent, options)
+	}
+	if err != nil {
+		return []*FileAction{}, err
+	}
+
+	output, err = normalizeFileActions(output, options.UnicodeNormalization)
+	if err != nil {
+		return []*FileAction{}, err
+	}
+
+	if options.FilenameProfile != "" {
+		output, err = validateFileActions(output, options.FilenameProfile, options.Sanitize)
+		if err != nil {
+			return []*FileAction{}, err
 		}
-		if fileInfo1, err := os.Stat(action.FullNewPath()); err == nil {
-			// Destination exists. Now check if the destination is also going to be
-			// renamed to something else (in which case, there is no error). Also
-			// OK if existing destination is going to be deleted.
-			ok := false
-			for _, action2 := range output {
-				if action2.kind == KIND_RENAME && action2.FullOldPath() == action.FullNewPath() {
-					ok = true
-					break
-				}
-				if action2.kind == KIND_DELETE && action2.FullOldPath() == action.FullNewPath() {
-					ok = true
-					break
-				}
-			}
+	}
 
-			// Also OK if new path and old path are in fact the same file (for example if
-			// "/path/to/abcd" is going to be renamed to "/path/to/ABCD" on a case
-			// insensitive file system).
-			fileInfo2, err := os.Stat(action.FullOldPath())
-			if err != nil {
-				return []*FileAction{}, errors.New(fmt.Sprintf("cannot stat \"%s\"", action.FullOldPath()))
-			}
-			if os.SameFile(fileInfo1, fileInfo2) {
-				ok = true
-			}
+	output, err = resolveCollisions(output, options.CollisionPolicy, options.CollisionFormat)
+	if err != nil {
+		return []*FileAction{}, err
+	}
 
-			if !ok {
-				return []*FileAction{}, errors.New(fmt.Sprintf("\"%s\" cannot be renamed to \"%s\": destination already exists", action.FullOldPath(), action.FullNewPath()))
-			}
+	output, err = addCompanionFileActions(output, options)
+	if err != nil {
+		return []*FileAction{}, err
+	}
+
+	if !options.SkipConflictChecks {
+		conflicts, err := fileActionConflicts(output)
+		if err != nil {
+			return []*FileAction{}, err
+		}
+		if len(conflicts) > 0 {
+			return []*FileAction{}, errors.New(conflicts[0].message)
 		}
 	}
 
-	// Loop through the actions and check that no two files are being
-	// renamed to the same name.
-	duplicateMap := make(map[string]bool)
+	// Loop through the actions and check the files that are inside a
+	// directory being deleted. Deleting them is redundant, and renaming
+	// them is not possible since deletions are done first.
+	var temp []*FileAction
 	for _, action := range output {
-		if action.kind != KIND_RENAME {
-			continue
+		deletedParent := ""
+		for _, action2 := range output {
+			if action2.kind == KIND_DELETE && pathIsUnder(action.FullOldPath(), action2.FullOldPath()) {
+				deletedParent = action2.FullOldPath()
+				break
+			}
 		}
-		if _, ok := duplicateMap[action.FullNewPath()]; ok {
-			return []*FileAction{}, errors.New(fmt.Sprintf("two files are being renamed to the same name: \"%s\"", action.FullNewPath()))
-		} else {
-			duplicateMap[action.FullNewPath()] = true
+
+		if deletedParent == "" {
+			temp = append(temp, action)
+		} else if action.kind == KIND_RENAME {
+			return []*FileAction{}, errors.New(fmt.Sprintf("\"%s\" cannot be renamed because its parent directory \"%s\" is being deleted", action.FullOldPath(), deletedParent))
 		}
 	}
 
-	return output, nil
+	return temp, nil
 }
 
 func deleteTempFiles() error {
@@ -536,11 +1196,18 @@ func deleteTempFiles() error {
 }
 
 func processFileActions(fileActions []*FileAction, dryRun bool) error {
-	var doneActions []*FileAction
-	var conflictActions []*FileAction // Actions that need a conflict resolution
+	_, err := processOperationFileActions(fileActions, dryRun, newHistoryOperation())
+	return err
+}
+
+// Processes the actions and records them in the history as part of the
+// operation. Returns the actions that have been done.
+func processOperationFileActions(fileActions []*FileAction, dryRun bool, operation *historyOperation) (doneActions []*FileAction, err error) {
+	var renameActions []*FileAction
+	var attributeActions []*FileAction
 
 	defer func() {
-		err := saveHistoryItems(doneActions)
+		err := saveOperationHistoryItems(doneActions, operation)
 		if err != nil {
 			logError("Could not save history items: %s", err)
 		}
@@ -563,17 +1230,9 @@ func processFileActions(fileActions []*FileAction, dryRun bool) error {
 				logInfo("\"%s\"  =>  \"%s\"", action.oldPath, action.newPath)
 			} else {
 				logDebug("\"%s\"  =>  \"%s\"", action.oldPath, action.newPath)
-				if _, err := os.Stat(action.FullNewPath()); err == nil {
-					u, _ := uuid.NewV4()
-					action.intermediatePath = action.FullNewPath() + "-" + u.String()
-					conflictActions = append(conflictActions, action)
-				} else {
-					os.MkdirAll(filepath.Dir(action.FullNewPath()), 0755)
-					err := os.Rename(action.FullOldPath(), action.FullNewPath())
-					if err != nil {
-						return err
-					}
-				}
+				// Added to doneActions once the rename has been done
+				renameActions = append(renameActions, action)
+				continue
 			}
 			break
 
@@ -602,10 +1261,15 @@ func processFileActions(fileActions []*FileAction, dryRun bool) error {
 			}
 			break
 
+		case KIND_TOUCH, KIND_CHMOD:
+
+			// Done once the files have been renamed
+			attributeActions = append(attributeActions, action)
+			continue
+
 		default:
 
 			panic("Invalid action type")
-			break
 
 		}
 
@@ -614,71 +1278,104 @@ func processFileActions(fileActions []*FileAction, dryRun bool) error {
 
 	deleteWaitGroup.Wait()
 
-	// Conflict resolution:
-	// - First rename all the problem paths to an intermediate name
-	// - Then rename all the intermediate one to the final name
-
-	for _, action := range conflictActions {
-		if action.kind != KIND_RENAME {
-			continue
-		}
-
-		err := os.Rename(action.FullOldPath(), action.intermediatePath)
-		if err != nil {
-			return err
-		}
+	renamedActions, err := processRenameSteps(renameSteps(renameActions))
+	doneActions = append(doneActions, renamedActions...)
+	if err != nil {
+		return doneActions, err
 	}
 
-	for _, action := range conflictActions {
-		if action.kind != KIND_RENAME {
-			continue
-		}
-
-		err := os.Rename(action.intermediatePath, action.FullNewPath())
+	for _, action := range attributeActions {
+		err = processAttributeAction(action, doneActions, dryRun)
 		if err != nil {
-			return err
+			return doneActions, err
+		}
+		if !dryRun {
+			doneActions = append(doneActions, action)
 		}
-
-		doneActions = append(doneActions, action)
 	}
 
-	return nil
+	return doneActions, nil
 }
 
 func createListFileContent(filePaths []string, includeHeader bool) string {
+	return createListFileContentWithOptions(filePaths, ListFileOptions{IncludeHeader: includeHeader})
+}
+
+func createListFileContentWithOptions(filePaths []string, options ListFileOptions) string {
 	output := ""
 	header := ""
 
-	if includeHeader {
+	commentMarker := options.Markers.commentMarker()
+
+	if options.IncludeHeader {
 		// NOTE: kr/text.Wrap returns lines separated by \n for all platforms.
 		// So here hard-code \n too. Later it will be changed to \r\n for Windows.
-		header = text.Wrap("Please change the filenames that need to be renamed and save the file. Lines that are not changed will be ignored (no file will be renamed).", LINE_LENGTH-3)
-		header += "\n"
-		header += "\n" + text.Wrap("You may delete a file by putting \"//\" at the beginning of the line. Note that this operation cannot be undone (though the file can be recovered from the trash on Windows and OSX).", LINE_LENGTH-3)
-		header += "\n"
-		header += "\n" + text.Wrap("Please do not swap the order of lines as this is what is used to match the original filenames to the new ones. Also do not delete lines as the rename operation will be cancelled due to a mismatch between the number of filenames before and after saving the file. You may test the effect of the rename operation using the --dry-run parameter.", LINE_LENGTH-3)
-		header += "\n"
-		header += "\n" + text.Wrap("Caveats: "+APPNAME+" expects filenames to be reasonably sane. Filenames that include newlines or non-printable characters for example will probably not work.", LINE_LENGTH-3)
-
-		headerLines := strings.Split(header, "\n")
+		hints := text.Wrap("Please change the filenames that need to be renamed and save the file. Lines that are not changed will be ignored (no file will be renamed).", LINE_LENGTH-3)
+		hints += "\n"
+		hints += "\n" + text.Wrap("You may delete a file by putting \""+options.Markers.deleteMarker()+"\" at the beginning of the line. Note that this operation cannot be undone (though the file can be recovered from the trash on Windows and OSX).", LINE_LENGTH-3)
+		hints += "\n"
+		if options.TwoColumns {
+			hints += "\n" + text.Wrap("Each line shows the original filename, then \""+strings.TrimSpace(PAIR_SEPARATOR)+"\", then the new filename. Only change the new filenames: the original ones are used to match the lines to the files, so the lines may be reordered but not deleted. You may test the effect of the rename operation using the --dry-run parameter.", LINE_LENGTH-3)
+		} else {
+			hints += "\n" + text.Wrap("Please do not swap the order of lines as this is what is used to match the original filenames to the new ones. Also do not delete lines as the rename operation will be cancelled due to a mismatch between the number of filenames before and after saving the file. You may test the effect of the rename operation using the --dry-run parameter.", LINE_LENGTH-3)
+		}
+		hints += "\n"
+		if len(options.Attributes) > 0 {
+			hints += "\n" + text.Wrap("The modification time and the mode of the files are shown between braces after the names, and are changed when they are edited.", LINE_LENGTH-3)
+			hints += "\n"
+		}
+		if len(options.Annotations) > 0 {
+			hints += "\n" + text.Wrap("The information shown between brackets after the names is ignored when the file is saved.", LINE_LENGTH-3)
+			hints += "\n"
+		}
+		if options.LockExtensions {
+			hints += "\n" + text.Wrap("The file extensions are shown after the names and are kept when the names are changed. To change an extension, edit it after the \""+commentMarker+"\". To remove it, leave nothing after the \""+commentMarker+"\".", LINE_LENGTH-3)
+			hints += "\n"
+		}
+		hints += "\n" + text.Wrap("Caveats: "+APPNAME+" expects filenames to be reasonably sane. Filenames that include newlines or non-printable characters for example will probably not work.", LINE_LENGTH-3)
+
+		headerLines := expandHeaderTemplate(options.HeaderTemplate, filePaths, hints, options.Markers)
 		temp := ""
-		for _, line := range headerLines {
-			if temp != "" {
+		for i, line := range headerLines {
+			if i > 0 {
 				temp += newline()
 			}
 			//  If empty line we don't want white-space
 			if line == "" {
-				temp += "//"
+				temp += commentMarker
 			} else {
-				temp += "// "
+				temp += commentMarker + " "
 			}
 			temp += line
 		}
 		header = temp + newline() + newline()
 	}
 
-	for _, filePath := range filePaths {
-		output += filepath.Base(filePath) + newline()
+	var originalNames []string
+	if options.TwoColumns {
+		originalNames = pairOriginalNames(filePaths)
+	}
+
+	for i, name := range transformedFilenames(filePaths, options.Transform) {
+		if options.LockExtensions {
+			name = lockedExtensionLine(name, commentMarker)
+		}
+		if options.TwoColumns {
+			name = pairLine(originalNames[i], name)
+		}
+		if len(options.Attributes) > 0 {
+			name += attributeComment(filePaths[i], options.Attributes, commentMarker)
+		}
+		if len(options.Annotations) > 0 {
+			name += annotationComment(filePaths[i], options.Annotations, commentMarker)
+		}
+		output += name + newline()
+
+		if options.ShowCompanions {
+			for _, companionPath := range options.Companions[filePaths[i]] {
+				output += companionComment(companionPath, commentMarker) + newline()
+			}
+		}
 	}
 
 	return header + output
@@ -686,7 +1383,7 @@ func createListFileContent(filePaths []string, includeHeader bool) string {
 
 func onExit() {
 	deleteTempFiles()
-	deleteOldHistoryItems(time.Now().Unix() - 60*60*24*7)
+	deleteOldHistoryItems(time.Now().Unix() - HISTORY_MAX_AGE)
 	profileClose()
 }
 
@@ -733,6 +1430,10 @@ func main() {
 		minLogLevel_ = 0
 	}
 
+	if (opts.Under != "" || opts.Since != "") && !opts.Undo {
+		criticalError(errors.New("--under and --since can only be used with --undo"))
+	}
+
 	err = profileOpen()
 	if err != nil {
 		logError(fmt.Sprintf("%s", err))
@@ -749,6 +1450,12 @@ func main() {
 		commandName = "undo"
 	} else if opts.Version {
 		commandName = "version"
+	} else if opts.HistoryExport != "" {
+		commandName = "history-export"
+	} else if opts.HistoryImport != "" {
+		commandName = "history-import"
+	} else if opts.NormalizeUnicode != "" {
+		commandName = "normalize-unicode"
 	} else {
 		commandName = "rename"
 	}
@@ -761,6 +1468,12 @@ func main() {
 		commandErr = handleUndoCommand(&opts, args)
 	case "version":
 		commandErr = handleVersionCommand(&opts, args)
+	case "history-export":
+		commandErr = handleHistoryExportCommand(&opts, args)
+	case "history-import":
+		commandErr = handleHistoryImportCommand(&opts, args)
+	case "normalize-unicode":
+		commandErr = handleNormalizeUnicodeCommand(&opts, args)
 	}
 
 	if commandErr != nil {
@@ -771,7 +1484,7 @@ func main() {
 		return
 	}
 
-	filePaths, err := filePathsFromArgs(args, config_.BoolD("include_directories", true))
+	filePaths, err := filePathsFromArgsWithOptions(args, filePathOptionsFromConfig(&opts))
 
 	if err != nil {
 		criticalError(err)
@@ -781,74 +1494,287 @@ func main() {
 		criticalError(errors.New("no file to rename"))
 	}
 
-	// -----------------------------------------------------------------------------------
-	// Build file list
-	// -----------------------------------------------------------------------------------
+	sortOrder := config_.StringD("sort", SORT_NAME)
+	if opts.Sort != "" {
+		sortOrder = opts.Sort
+	}
 
-	listFileContent := createListFileContent(filePaths, config_.BoolD("include_header", true))
-	filenameUuid, _ := uuid.NewV4()
-	listFilePath := filepath.Join(tempFolder(), filenameUuid.String()+".files.txt")
-	ioutil.WriteFile(listFilePath, []byte(listFileContent), PROFILE_PERM)
+	err = sortFilePaths(filePaths, sortOrder, opts.Reverse || config_.BoolD("sort_reverse", false))
+	if err != nil {
+		criticalError(err)
+	}
+
+	companionSpec := config_.String("companion_files")
+	if opts.Companions != "" {
+		companionSpec = opts.Companions
+	}
+
+	companionGroups, err := parseCompanionGroups(companionSpec)
+	if err != nil {
+		criticalError(err)
+	}
+
+	filePaths, companions, err := findCompanionFiles(filePaths, companionGroups)
+	if err != nil {
+		criticalError(err)
+	}
+
+	fileActionOptions := FileActionOptions{
+		FilenameProfile:      config_.StringD("filename_profile", defaultFilenameProfile()),
+		Sanitize:             opts.Sanitize,
+		UnicodeNormalization: config_.String("unicode_normalization"),
+		CollisionPolicy:      config_.StringD("collision_policy", COLLISION_ABORT),
+		CollisionFormat:      config_.StringD("collision_format", DEFAULT_COLLISION_FORMAT),
+		Companions:           companions,
+	}
+
+	if opts.OnCollision != "" {
+		fileActionOptions.CollisionPolicy = opts.OnCollision
+	}
+
+	lockExtensions := opts.LockExtensions || config_.BoolD("lock_extensions", false)
+
+	bufferFormat := config_.StringD("buffer_format", BUFFER_FORMAT_NAMES)
+	if opts.BufferFormat != "" {
+		bufferFormat = opts.BufferFormat
+	}
+
+	twoColumns, err := isTwoColumnBufferFormat(bufferFormat)
+	if err != nil {
+		criticalError(err)
+	}
+
+	markers := BufferMarkers{
+		Comment: config_.String("comment_marker"),
+		Delete:  config_.String("delete_marker"),
+	}
+
+	err = markers.validate()
+	if err != nil {
+		criticalError(err)
+	}
+
+	fileActionOptions.Markers = markers
+
+	annotationSpec := config_.String("annotations")
+	if opts.Annotate != "" {
+		annotationSpec = opts.Annotate
+	}
+
+	annotations, err := parseAnnotations(annotationSpec)
+	if err != nil {
+		criticalError(err)
+	}
+
+	attributeSpec := config_.String("attributes")
+	if opts.Attributes != "" {
+		attributeSpec = opts.Attributes
+	}
+
+	attributes, err := parseAttributes(attributeSpec)
+	if err != nil {
+		criticalError(err)
+	}
+
+	var transform filenameTransform
+	if len(opts.Transform) > 0 {
+		transform, err = parseFilenameTransforms(opts.Transform, !opts.TransformExtension)
+		if err != nil {
+			criticalError(err)
+		}
+	} else if opts.NoEdit {
+		criticalError(errors.New("--no-edit can only be used with --transform"))
+	}
+
+	confirm := confirmationRequested(&opts)
+	if confirm && opts.Live {
+		criticalError(errors.New("--live cannot be used with confirm, since the changes are applied every time the file list is saved (use --yes to skip the confirmation)"))
+	}
 
 	// -----------------------------------------------------------------------------------
-	// Watch for changes in file list
+	// Apply the transforms directly if the editor is not needed
 	// -----------------------------------------------------------------------------------
 
-	waitForFileChange := make(chan bool)
-	waitForCommand := make(chan bool)
+	if opts.NoEdit {
+		content := createListFileContentWithOptions(filePaths, ListFileOptions{Transform: transform})
+		actions, err := fileActionsWithOptions(filePaths, content, fileActionOptions)
+		if err != nil {
+			criticalError(err)
+		}
 
-	go func(doneChan chan bool) {
-		defer func() {
-			doneChan <- true
-		}()
+		if confirm {
+			apply, err := confirmFileActionsOnce(actions)
+			if err != nil {
+				criticalError(err)
+			}
+			if !apply {
+				return
+			}
+		}
 
-		logInfo("Waiting for file list to be saved... (Press Ctrl + C to abort)")
-		err := watchFile(listFilePath)
+		err = processFileActions(actions, opts.DryRun)
 		if err != nil {
 			criticalError(err)
 		}
-	}(waitForFileChange)
+		return
+	}
 
 	// -----------------------------------------------------------------------------------
-	// Launch text editor
+	// Use the built-in editor if requested or if there is no text editor
 	// -----------------------------------------------------------------------------------
 
-	go func(doneChan chan bool) {
-		defer func() {
-			doneChan <- true
-		}()
+	useTui := opts.Tui || config_.String("editor") == "tui"
+	if !useTui && config_.String("editor") == "" && isTerminalAvailable() {
+		if _, err := guessEditorCommand(); err != nil {
+			logInfo("No text editor could be found. Using the built-in editor. Run `%s --config editor \"name-of-editor\"` to set up a text editor.", APPNAME)
+			useTui = true
+		}
+	}
 
-		err := editFile(listFilePath)
+	if useTui {
+		if opts.Live {
+			criticalError(errors.New("--live cannot be used with the built-in editor"))
+		}
+
+		content, apply, err := runTuiEditor(filePaths, transformedFilenames(filePaths, transform), fileActionOptions)
 		if err != nil {
 			criticalError(err)
 		}
-	}(waitForCommand)
 
-	<-waitForCommand
-	<-waitForFileChange
+		if !apply {
+			logInfo("The operation has been cancelled. No file has been renamed.")
+			return
+		}
 
-	// -----------------------------------------------------------------------------------
-	// Check that the filenames have not been changed while the list was being edited
-	// -----------------------------------------------------------------------------------
+		actions, err := fileActionsWithOptions(filePaths, content, fileActionOptions)
+		if err != nil {
+			criticalError(err)
+		}
+
+		if confirm {
+			apply, err := confirmFileActionsOnce(actions)
+			if err != nil {
+				criticalError(err)
+			}
+			if !apply {
+				return
+			}
+		}
 
-	for _, filePath := range filePaths {
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			criticalError(errors.New("Filenames have been changed or some files have been deleted or moved while the list was being edited. To avoid any data loss, the operation has been aborted. You may resume it by running the same command."))
+		err = processFileActions(actions, opts.DryRun)
+		if err != nil {
+			criticalError(err)
 		}
+		return
 	}
 
 	// -----------------------------------------------------------------------------------
-	// Get new filenames from list file
+	// Build file list
 	// -----------------------------------------------------------------------------------
 
-	changedContent, err := ioutil.ReadFile(listFilePath)
-	if err != nil {
-		criticalError(err)
+	listFileOptions := ListFileOptions{
+		IncludeHeader:  config_.BoolD("include_header", true),
+		Transform:      transform,
+		LockExtensions: lockExtensions,
+		Companions:     companions,
+		ShowCompanions: config_.BoolD("show_companions", true),
+		TwoColumns:     twoColumns,
+		HeaderTemplate: config_.String("header_template"),
+		Markers:        markers,
+		Annotations:    annotations,
+		Attributes:     attributes,
 	}
+	listFileContent := createListFileContentWithOptions(filePaths, listFileOptions)
+	fileActionOptions.LockExtensions = lockExtensions
+	fileActionOptions.TwoColumns = twoColumns
+	fileActionOptions.Annotations = len(annotations) > 0
+	fileActionOptions.Attributes = len(attributes) > 0
+	filenameUuid, _ := uuid.NewV4()
+	listFilePath := filepath.Join(tempFolder(), filenameUuid.String()+".files.txt")
+	ioutil.WriteFile(listFilePath, []byte(listFileContent), PROFILE_PERM)
 
-	actions, err := fileActions(filePaths, string(changedContent))
-	if err != nil {
-		criticalError(err)
+	if opts.Live {
+		session := liveSession{
+			listFilePath:  listFilePath,
+			filePaths:     filePaths,
+			listOptions:   listFileOptions,
+			actionOptions: fileActionOptions,
+			dryRun:        opts.DryRun,
+		}
+
+		err = session.run()
+		if err != nil {
+			criticalError(err)
+		}
+		return
+	}
+
+	var actions []*FileAction
+	for editCount := 0; ; editCount++ {
+
+		// -----------------------------------------------------------------------------------
+		// Launch text editor and wait for the file list to be saved
+		// -----------------------------------------------------------------------------------
+
+		changed, err := editListFile(listFilePath)
+		if err != nil {
+			criticalError(err)
+		}
+
+		// When editing again, keeping the file list as it is means that the
+		// previous changes are still wanted.
+		if !changed && editCount == 0 {
+			logInfo("The editor exited without saving any change to the file list. No file has been renamed.")
+			os.Remove(listFilePath)
+			return
+		}
+
+		// -----------------------------------------------------------------------------------
+		// Check that the filenames have not been changed while the list was being edited
+		// -----------------------------------------------------------------------------------
+
+		for _, filePath := range filePaths {
+			if _, err := os.Stat(filePath); os.IsNotExist(err) {
+				criticalError(errors.New("Filenames have been changed or some files have been deleted or moved while the list was being edited. To avoid any data loss, the operation has been aborted. You may resume it by running the same command."))
+			}
+		}
+
+		// -----------------------------------------------------------------------------------
+		// Get new filenames from list file
+		// -----------------------------------------------------------------------------------
+
+		changedContent, err := ioutil.ReadFile(listFilePath)
+		if err != nil {
+			criticalError(err)
+		}
+
+		actions, err = fileActionsWithOptions(filePaths, string(changedContent), fileActionOptions)
+		if err != nil {
+			criticalError(err)
+		}
+
+		if !confirm || len(actions) == 0 {
+			break
+		}
+
+		// -----------------------------------------------------------------------------------
+		// Show the changes and ask for confirmation
+		// -----------------------------------------------------------------------------------
+
+		answer, err := confirmFileActions(actions, true)
+		if err != nil {
+			criticalError(err)
+		}
+
+		if answer == CONFIRM_NO {
+			logInfo("The operation has been cancelled. No file has been renamed.")
+			os.Remove(listFilePath)
+			return
+		}
+
+		if answer == CONFIRM_YES {
+			break
+		}
 	}
 
 	// -----------------------------------------------------------------------------------
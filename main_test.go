@@ -545,6 +545,45 @@ func Test_processFileActions_swapFilenames(t *testing.T) {
 	}
 }
 
+func Test_processFileActions_destinationCreatedAfterCheck(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	p0 := filepath.Join(tempFolder(), "0")
+	p1 := filepath.Join(tempFolder(), "1")
+
+	filePutContent(p0, "0")
+
+	originalFilePaths := []string{
+		p0,
+	}
+
+	changes := `
+1
+`
+	actions, err := fileActions(originalFilePaths, changes)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	// Simulates another process creating the destination after
+	// fileActions() has checked it.
+	filePutContent(p1, "1")
+
+	err = processFileActions(actions, false)
+	if err == nil {
+		t.Error("Expected an error, but got nil.")
+	}
+
+	if fileGetContent(p1) != "1" {
+		t.Error("Destination has been overwritten")
+	}
+
+	if fileGetContent(p0) != "0" {
+		t.Error("Source should not have been moved")
+	}
+}
+
 func Test_processFileActions_renameToSameName(t *testing.T) {
 	setup(t)
 	defer teardown(t)
@@ -892,3 +931,227 @@ func Test_bufferHeader(t *testing.T) {
 		t.Fatal("file content is incorrect: " + content)
 	}
 }
+
+func Test_processFileActions_directoryAndContent(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	dir := filepath.Join(tempFolder(), "dir")
+	os.MkdirAll(filepath.Join(dir, "sub"), 0700)
+	filePutContent(filepath.Join(dir, "a"), "a")
+	filePutContent(filepath.Join(dir, "sub", "b"), "b")
+
+	originalFilePaths := []string{
+		dir,
+		filepath.Join(dir, "a"),
+		filepath.Join(dir, "sub"),
+		filepath.Join(dir, "sub", "b"),
+	}
+
+	changes := `
+dir2
+a2
+sub2
+b2
+`
+	actions, err := fileActions(originalFilePaths, changes)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = processFileActions(actions, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if fileGetContent(filepath.Join(tempFolder(), "dir2", "a2")) != "a" {
+		t.Error("File in renamed directory has not been renamed")
+	}
+
+	if fileGetContent(filepath.Join(tempFolder(), "dir2", "sub2", "b2")) != "b" {
+		t.Error("File in renamed sub-directory has not been renamed")
+	}
+
+	opts := CommandLineOptions{
+		Under: tempFolder(),
+	}
+	err = handleUndoCommand(&opts, []string{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if fileGetContent(filepath.Join(dir, "a")) != "a" || fileGetContent(filepath.Join(dir, "sub", "b")) != "b" {
+		t.Error("Undo operation did not restore filenames")
+	}
+}
+
+func Test_fileActions_deletedDirectory(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	dir := filepath.Join(tempFolder(), "dir")
+	os.Mkdir(dir, 0700)
+	touch(filepath.Join(dir, "a"))
+	touch(filepath.Join(dir, "b"))
+
+	originalFilePaths := []string{
+		dir,
+		filepath.Join(dir, "a"),
+		filepath.Join(dir, "b"),
+	}
+
+	actions, err := fileActions(originalFilePaths, "//dir\n//a\nb\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(actions) != 1 || actions[0].FullOldPath() != normalizePath(dir) {
+		t.Errorf("Expected only the directory to be deleted, got %v", actions)
+	}
+
+	_, err = fileActions(originalFilePaths, "//dir\na\nb2\n")
+	if err == nil {
+		t.Error("Expected an error, but got nil.")
+	}
+}
+
+func Test_filePathsFromArgsWithOptions(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	for _, name := range []string{"a.txt", "b.tmp", ".hidden", "node_modules", "build"} {
+		touch(filepath.Join(tempFolder(), name))
+	}
+
+	args := []string{filepath.Join(tempFolder(), "*")}
+
+	filePaths, _ := filePathsFromArgsWithOptions(args, FilePathOptions{IncludeHidden: true})
+	if len(filePaths) != 5 {
+		t.Errorf("Expected 5 files, got %d", len(filePaths))
+	}
+
+	filePaths, _ = filePathsFromArgsWithOptions(args, FilePathOptions{
+		IncludeHidden: false,
+		Excludes:      []string{"node_modules", "*.tmp", filepath.Base(tempFolder()) + "/build"},
+	})
+	err := fileListsAreEqual(filePaths, []string{filepath.Join(tempFolder(), "a.txt")})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_filePathsFromArgsWithOptions_excludedDirectories(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	for _, name := range []string{"a.js", "node_modules/pkg/index.js", ".git/hooks/x.js", "src/.cache/b.js", "src/c.js"} {
+		path := filepath.Join(tempFolder(), filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		touch(path)
+	}
+
+	args := []string{filepath.Join(tempFolder(), "**", "*.js")}
+
+	filePaths, _ := filePathsFromArgsWithOptions(args, FilePathOptions{
+		IncludeHidden: false,
+		Excludes:      []string{"node_modules"},
+	})
+	err := fileListsAreEqual(filePaths, []string{
+		filepath.Join(tempFolder(), "a.js"),
+		filepath.Join(tempFolder(), "src", "c.js"),
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// A directory named in the pattern is searched
+	args = []string{filepath.Join(tempFolder(), "node_modules", "**", "*.js")}
+	filePaths, _ = filePathsFromArgsWithOptions(args, FilePathOptions{
+		IncludeHidden: false,
+		Excludes:      []string{"node_modules"},
+	})
+	err = fileListsAreEqual(filePaths, []string{filepath.Join(tempFolder(), "node_modules", "pkg", "index.js")})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_isExcluded(t *testing.T) {
+	testCases := []struct {
+		path     string
+		pattern  string
+		expected bool
+	}{
+		{"project/node_modules", "node_modules", true},
+		{"project/node_modules", "node_*", true},
+		{"project/build/main.o", "build/*.o", true},
+		{"project/build/main.o", "project/build/*.o", true},
+		{"project/build/main.o", "other/build/*.o", false},
+		{"project/build/main.o", "build", false},
+		{"project/main.go", "*.o", false},
+		{"a/b/c/d.txt", "a/**/d.txt", true},
+	}
+
+	for _, testCase := range testCases {
+		actual := isExcluded(testCase.path, []string{testCase.pattern})
+		if actual != testCase.expected {
+			t.Errorf("\"%s\" / \"%s\": expected %t, got %t", testCase.path, testCase.pattern, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_filePathsFromArgs_stdin(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	f0 := filepath.Join(tempFolder(), "0")
+	f1 := filepath.Join(tempFolder(), "with\nnewline")
+	f2 := filepath.Join(tempFolder(), "2")
+	touch(f0)
+	touch(f1)
+	touch(f2)
+
+	filePaths, err := filePathsFromArgsWithOptions([]string{"-"}, FilePathOptions{
+		IncludeHidden: true,
+		Stdin:         strings.NewReader(f0 + "\r\n" + f2 + "\n\n" + f0 + "\n"),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = fileListsAreEqual(filePaths, []string{f0, f2})
+	if err != nil {
+		t.Error(err)
+	}
+
+	filePaths, err = filePathsFromArgsWithOptions([]string{"-", f2}, FilePathOptions{
+		IncludeHidden: true,
+		Stdin:         strings.NewReader(f0 + "\x00" + f2 + "\x00"),
+		NullSeparated: true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	err = fileListsAreEqual(filePaths, []string{f0, f2})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// A name with a line break would span several lines of the file list
+	_, err = filePathsFromArgsWithOptions([]string{"-"}, FilePathOptions{
+		IncludeHidden: true,
+		Stdin:         strings.NewReader(f0 + "\x00" + f1 + "\x00" + f2 + "\x00"),
+		NullSeparated: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "with\\nnewline") {
+		t.Errorf("Expected an error about %q, got %v", f1, err)
+	}
+
+	_, err = filePathsFromArgsWithOptions([]string{"-"}, FilePathOptions{
+		Stdin: strings.NewReader(f0 + "\n" + filepath.Join(tempFolder(), "missing") + "\n"),
+	})
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Files smaller than this are copied without reporting the progress.
+const COPY_PROGRESS_MIN_SIZE = 10 * 1024 * 1024
+
+type copyProgress struct {
+	name        string
+	total       int64
+	done        int64
+	lastPercent int64
+}
+
+func (this *copyProgress) Write(p []byte) (int, error) {
+	this.done += int64(len(p))
+	if this.total < COPY_PROGRESS_MIN_SIZE {
+		return len(p), nil
+	}
+
+	percent := this.done * 100 / this.total
+	if percent/10 > this.lastPercent/10 {
+		logInfo("Copying \"%s\": %d%%", this.name, percent)
+	}
+	this.lastPercent = percent
+	return len(p), nil
+}
+
+// Moves oldPath to newPath without overwriting newPath if it exists (see
+// renameNoReplace()). If the paths are on different devices, the file or
+// directory is copied, verified and then deleted.
+func moveFile(oldPath string, newPath string) error {
+	err := renameNoReplace(oldPath, newPath)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	logInfo("\"%s\" is on a different device than \"%s\". It is going to be copied then deleted.", oldPath, newPath)
+	return moveAcrossDevices(oldPath, newPath)
+}
+
+func moveAcrossDevices(oldPath string, newPath string) error {
+	if _, err := os.Lstat(newPath); err == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+
+	total, err := treeSize(oldPath)
+	if err != nil {
+		return err
+	}
+
+	progress := &copyProgress{name: oldPath, total: total}
+	err = copyTree(oldPath, newPath, progress)
+	if err != nil {
+		// Whatever is at newPath has been created by copyTree(), unless it
+		// has been created by another process in the meantime.
+		if !copyDestinationExisted(err, newPath) {
+			os.RemoveAll(newPath)
+		}
+		return err
+	}
+
+	return os.RemoveAll(oldPath)
+}
+
+// Tells whether copyTree() failed because the destination itself already
+// existed, in which case it has not been created by copyTree() and must not
+// be removed.
+func copyDestinationExisted(err error, newPath string) bool {
+	if !errors.Is(err, os.ErrExist) {
+		return false
+	}
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Path == newPath
+	}
+
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.New == newPath
+	}
+
+	return false
+}
+
+func treeSize(path string) (int64, error) {
+	var output int64
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			output += info.Size()
+		}
+		return nil
+	})
+	return output, err
+}
+
+func copyTree(oldPath string, newPath string, progress *copyProgress) error {
+	info, err := os.Lstat(oldPath)
+	if err != nil {
+		return err
+	}
+
+	switch {
+
+	case info.Mode()&os.ModeSymlink != 0:
+
+		target, err := os.Readlink(oldPath)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, newPath)
+
+	case info.IsDir():
+
+		// The final permissions are set once the content has been copied, in
+		// case the directory is read-only.
+		err = os.Mkdir(newPath, 0700)
+		if err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(oldPath)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			err = copyTree(filepath.Join(oldPath, entry.Name()), filepath.Join(newPath, entry.Name()), progress)
+			if err != nil {
+				return err
+			}
+		}
+
+	case info.Mode().IsRegular():
+
+		err = copyFile(oldPath, newPath, info, progress)
+		if err != nil {
+			return err
+		}
+
+	default:
+
+		return errors.New(fmt.Sprintf("\"%s\" cannot be moved to another device: unsupported file type", oldPath))
+
+	}
+
+	err = copyXattrs(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(newPath, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	// Done last since adding files to a directory changes its timestamps.
+	return os.Chtimes(newPath, info.ModTime(), info.ModTime())
+}
+
+// Copies the file content and checks that the copy has the same size and
+// checksum as the original.
+func copyFile(oldPath string, newPath string, info os.FileInfo, progress *copyProgress) error {
+	src, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(newPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	srcHash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, srcHash, progress), src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	err = dst.Sync()
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+
+	dstHash, dstSize, err := fileChecksum(newPath)
+	if err != nil {
+		return err
+	}
+
+	if dstSize != info.Size() || !bytes.Equal(dstHash, srcHash.Sum(nil)) {
+		return errors.New(fmt.Sprintf("copy of \"%s\" to \"%s\" is corrupted: checksum or size mismatch", oldPath, newPath))
+	}
+
+	return nil
+}
+
+func fileChecksum(path string) ([]byte, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return h.Sum(nil), size, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_moveAcrossDevices(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	src := filepath.Join(tempFolder(), "src")
+	dst := filepath.Join(tempFolder(), "dst")
+	mtime := time.Date(2015, 6, 10, 14, 30, 0, 0, time.Local)
+
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	filePutContent(filepath.Join(src, "one"), "1")
+	filePutContent(filepath.Join(src, "sub", "two"), "2")
+	os.Chmod(filepath.Join(src, "one"), 0640)
+	os.Chtimes(filepath.Join(src, "one"), mtime, mtime)
+	os.Symlink("one", filepath.Join(src, "link"))
+	os.Chtimes(src, mtime, mtime)
+
+	err := moveAcrossDevices(src, dst)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if fileExists(src) {
+		t.Error("Source should have been deleted")
+	}
+
+	if fileGetContent(filepath.Join(dst, "one")) != "1" || fileGetContent(filepath.Join(dst, "sub", "two")) != "2" {
+		t.Error("Files have not been copied")
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+	}
+
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected time %s, got %s", mtime, info.ModTime())
+	}
+
+	info, _ = os.Stat(dst)
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Directory time has not been preserved: %s", info.ModTime())
+	}
+
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	if err != nil || target != "one" {
+		t.Error("Symlink has not been copied")
+	}
+}
+
+func Test_moveAcrossDevices_noOverwrite(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	p0 := filepath.Join(tempFolder(), "0")
+	p1 := filepath.Join(tempFolder(), "1")
+	filePutContent(p0, "0")
+	filePutContent(p1, "1")
+
+	err := moveAcrossDevices(p0, p1)
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected os.ErrExist, got %v", err)
+	}
+
+	if fileGetContent(p0) != "0" || fileGetContent(p1) != "1" {
+		t.Error("Files should not have been changed")
+	}
+}
+
+func Test_copyDestinationExisted(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	src := filepath.Join(tempFolder(), "src")
+	dst := filepath.Join(tempFolder(), "dst")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	filePutContent(filepath.Join(src, "sub", "one"), "1")
+
+	// The destination has been created by another process after it has
+	// been checked, so it must be left as it is.
+	filePutContent(dst, "other")
+	err := copyTree(src, dst, &copyProgress{})
+	if !copyDestinationExisted(err, dst) {
+		t.Errorf("Expected the destination to be reported as existing, got %v", err)
+	}
+
+	// A file that already exists inside the destination means that the
+	// destination itself has been created by copyTree().
+	os.Remove(dst)
+	err = copyTree(src, dst, &copyProgress{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	err = copyTree(filepath.Join(src, "sub", "one"), filepath.Join(dst, "sub", "one"), &copyProgress{})
+	if !errors.Is(err, os.ErrExist) || copyDestinationExisted(err, dst) {
+		t.Errorf("Expected an error about a file inside the destination, got %v", err)
+	}
+}
+
+func Test_copyProgress(t *testing.T) {
+	minLogLevel_ = 10
+
+	progress := &copyProgress{name: "test", total: COPY_PROGRESS_MIN_SIZE * 2}
+	buffer := make([]byte, COPY_PROGRESS_MIN_SIZE/2)
+	for i := 0; i < 4; i++ {
+		progress.Write(buffer)
+	}
+
+	if progress.done != progress.total || progress.lastPercent != 100 {
+		t.Errorf("Expected 100%%, got %d%%", progress.lastPercent)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// In the two-column buffer format, each line shows the original name
+// followed by the new name. eg. "IMG_001.jpg => beach.jpg"
+const PAIR_SEPARATOR = " => "
+
+const (
+	BUFFER_FORMAT_NAMES = "names"
+	BUFFER_FORMAT_PAIRS = "pairs"
+)
+
+// Tells whether the buffer format is the two-column one.
+func isTwoColumnBufferFormat(format string) (bool, error) {
+	switch strings.ToLower(format) {
+	case "", BUFFER_FORMAT_NAMES:
+		return false, nil
+	case BUFFER_FORMAT_PAIRS:
+		return true, nil
+	}
+	return false, errors.New(fmt.Sprintf("invalid buffer format: \"%s\". Possible values: %s or %s", format, BUFFER_FORMAT_NAMES, BUFFER_FORMAT_PAIRS))
+}
+
+func pairLine(originalName string, newName string) string {
+	return originalName + PAIR_SEPARATOR + newName
+}
+
+// Returns the names written in the left column. The name of a file is its
+// base name, unless another file in the list has the same base name, in
+// which case it is its path relative to the directory that contains all the
+// files, so that each line can only match one file.
+func pairOriginalNames(originalFilePaths []string) []string {
+	counts := make(map[string]int)
+	for _, path := range originalFilePaths {
+		counts[filepath.Base(path)]++
+	}
+
+	root := commonDirectory(originalFilePaths)
+
+	output := make([]string, len(originalFilePaths))
+	for i, path := range originalFilePaths {
+		output[i] = filepath.Base(path)
+		if counts[output[i]] == 1 {
+			continue
+		}
+		if rel, err := filepath.Rel(root, normalizePath(path)); err == nil {
+			output[i] = rel
+		}
+	}
+	return output
+}
+
+// Original files that have not been matched to a line yet, by the name
+// written in the left column.
+type pairMatcher struct {
+	remaining map[string]int
+	matched   map[string]bool
+}
+
+func newPairMatcher(originalFilePaths []string) *pairMatcher {
+	output := &pairMatcher{
+		remaining: make(map[string]int),
+		matched:   make(map[string]bool),
+	}
+	for i, name := range pairOriginalNames(originalFilePaths) {
+		output.remaining[name] = i
+	}
+	return output
+}
+
+func (this *pairMatcher) isOriginalName(name string) bool {
+	_, ok := this.remaining[name]
+	return ok || this.matched[name]
+}
+
+// Splits the line into the original name and the new name. Since both
+// names can contain the separator, the original name is the first part of
+// the line, ending with a separator, that is one of the original names.
+func (this *pairMatcher) split(line string) (originalName string, newName string, ok bool) {
+	start := 0
+	for {
+		index := strings.Index(line[start:], PAIR_SEPARATOR)
+		if index < 0 {
+			return "", "", false
+		}
+		index += start
+		originalName = line[:index]
+		if this.isOriginalName(originalName) {
+			return originalName, line[index+len(PAIR_SEPARATOR):], true
+		}
+		start = index + 1
+	}
+}
+
+// Returns the index of the original file with this name, or -1 if it has
+// been matched already.
+func (this *pairMatcher) match(originalName string) int {
+	index, ok := this.remaining[originalName]
+	if !ok {
+		return -1
+	}
+	delete(this.remaining, originalName)
+	this.matched[originalName] = true
+	return index
+}
+
+// Parses a buffer in the two-column format. The lines are matched to the
+// original files by their left side, so they can be in any order, but each
+// original file must have exactly one line. A file is deleted by putting
+// the delete marker at the beginning of its line.
+func pairFileActions(originalFilePaths []string, changedContent string, options FileActionOptions) ([]*FileAction, error) {
+	lines := bufferLines(decodeBuffer(changedContent))
+	matcher := newPairMatcher(originalFilePaths)
+
+	var output []*FileAction
+
+	for i, line := range lines {
+		line := strings.Trim(line, "\n\r")
+
+		if line == "" {
+			continue
+		}
+
+		if options.Annotations {
+			line = stripAnnotationComment(line, options.Markers.commentMarker())
+		}
+
+		attributeValues := make(map[string]string)
+		if options.Attributes {
+			var err error
+			line, attributeValues, err = parseAttributeComment(line, options.Markers.commentMarker())
+			if err != nil {
+				return []*FileAction{}, errors.New(fmt.Sprintf("line %d: %s", i+1, err))
+			}
+		}
+
+		actionKind := KIND_RENAME
+		originalName, newName, ok := "", "", false
+
+		if deletedName, isDeleteLine := options.Markers.deletedName(line); isDeleteLine {
+			originalName, _, ok = matcher.split(deletedName)
+			if !ok && matcher.isOriginalName(deletedName) {
+				// The new name can be left out when deleting a file
+				originalName, ok = deletedName, true
+			}
+			if ok {
+				actionKind = KIND_DELETE
+			}
+		}
+
+		if !ok {
+			originalName, newName, ok = matcher.split(line)
+			if !ok && options.Markers.isComment(line) {
+				// Regular comment, unless the line starts with the name of
+				// a file that itself starts with the comment marker.
+				continue
+			}
+		}
+
+		if !ok {
+			if !strings.Contains(line, PAIR_SEPARATOR) {
+				return []*FileAction{}, errors.New(fmt.Sprintf("line %d: the original filename and the new filename must be separated by \"%s\"", i+1, PAIR_SEPARATOR))
+			}
+			return []*FileAction{}, errors.New(fmt.Sprintf("line %d: the original filename has been changed or is not one of the files being renamed: \"%s\"", i+1, line))
+		}
+
+		fileIndex := matcher.match(originalName)
+		if fileIndex < 0 {
+			return []*FileAction{}, errors.New(fmt.Sprintf("line %d: \"%s\" is listed more than once", i+1, originalName))
+		}
+
+		name := filepath.Base(originalFilePaths[fileIndex])
+
+		if options.LockExtensions && actionKind == KIND_RENAME {
+			newName = unlockExtensionLine(newName, name, options.Markers.commentMarker())
+		}
+
+		if actionKind == KIND_RENAME && newName == "" {
+			return []*FileAction{}, errors.New(fmt.Sprintf("line %d: the new filename of \"%s\" is empty", i+1, originalName))
+		}
+
+		if actionKind == KIND_RENAME && newName == name {
+			// Found a match but nothing to actually rename
+		} else {
+			action := NewFileAction()
+			action.kind = actionKind
+			action.oldPath = originalFilePaths[fileIndex]
+			if actionKind == KIND_RENAME {
+				action.newPath = newName
+			}
+			action.line = i + 1
+
+			output = append(output, action)
+		}
+
+		if actionKind == KIND_RENAME {
+			attributeActions, err := attributeFileActions(originalFilePaths[fileIndex], attributeValues, i+1)
+			if err != nil {
+				return []*FileAction{}, err
+			}
+			output = append(output, attributeActions...)
+		}
+	}
+
+	// Sanity check
+	missingName := ""
+	missingIndex := -1
+	for name, index := range matcher.remaining {
+		if missingIndex < 0 || index < missingIndex {
+			missingName, missingIndex = name, index
+		}
+	}
+	if missingIndex >= 0 {
+		return []*FileAction{}, errors.New(fmt.Sprintf("not all files had a match: \"%s\" is missing from the file list", missingName))
+	}
+
+	return output, nil
+}
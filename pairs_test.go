@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_isTwoColumnBufferFormat(t *testing.T) {
+	for format, expected := range map[string]bool{"": false, "names": false, "pairs": true, "PAIRS": true} {
+		actual, err := isTwoColumnBufferFormat(format)
+		if err != nil {
+			t.Errorf("\"%s\": expected no error, got %s", format, err)
+		}
+		if actual != expected {
+			t.Errorf("\"%s\": expected %t, got %t", format, expected, actual)
+		}
+	}
+
+	if _, err := isTwoColumnBufferFormat("columns"); err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
+
+func Test_fileActionsWithOptions_twoColumns(t *testing.T) {
+	newline_ = "\n"
+
+	paths := []string{"/tmp/a/beach.jpg", "/tmp/a/x => y.txt", "/tmp/a/old.txt", "/tmp/b/old.txt", "/tmp/a/notes.txt"}
+
+	// The files with the same name are written with their relative path
+	a := filepath.Join("a", "old.txt")
+	b := filepath.Join("b", "old.txt")
+
+	content := createListFileContentWithOptions(paths, ListFileOptions{TwoColumns: true})
+	expected := "beach.jpg => beach.jpg\nx => y.txt => x => y.txt\n" + a + " => old.txt\n" + b + " => old.txt\nnotes.txt => notes.txt\n"
+	if content != expected {
+		t.Fatalf("Expected \"%s\", got \"%s\"", expected, content)
+	}
+
+	// Unchanged buffer
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{TwoColumns: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(actions) != 0 {
+		t.Errorf("Expected no action, got %d", len(actions))
+	}
+
+	// Reordered lines, names containing the separator, a deleted file and
+	// two files with the same name.
+	content = "// Comment\nnotes.txt => notes.md\nx => y.txt => y => z.txt\n" + b + " => second.txt\n// beach.jpg\n" + a + " => first.txt\n"
+	actions, err = fileActionsWithOptions(paths, content, FileActionOptions{TwoColumns: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expectedActions := [][]string{
+		{"/tmp/a/notes.txt", "notes.md"},
+		{"/tmp/a/x => y.txt", "y => z.txt"},
+		{"/tmp/b/old.txt", "second.txt"},
+		{"/tmp/a/beach.jpg", ""},
+		{"/tmp/a/old.txt", "first.txt"},
+	}
+
+	if len(actions) != len(expectedActions) {
+		t.Fatalf("Expected %d actions, got %d", len(expectedActions), len(actions))
+	}
+
+	for i, action := range actions {
+		if action.oldPath != expectedActions[i][0] || action.newPath != expectedActions[i][1] {
+			t.Errorf("Expected %v, got %s", expectedActions[i], action)
+		}
+	}
+
+	if actions[3].kind != KIND_DELETE || actions[3].line != 5 {
+		t.Errorf("Expected \"beach.jpg\" to be deleted on line 5, got %s", actions[3])
+	}
+
+	// Locked extensions
+	content = createListFileContentWithOptions(paths[:1], ListFileOptions{TwoColumns: true, LockExtensions: true})
+	if content != "beach.jpg => beach\t// .jpg\n" {
+		t.Errorf("Unexpected content: \"%s\"", content)
+	}
+
+	actions, err = fileActionsWithOptions(paths[:1], "beach.jpg => sunset\t// .jpg\n", FileActionOptions{TwoColumns: true, LockExtensions: true})
+	if err != nil || len(actions) != 1 || actions[0].newPath != "sunset.jpg" {
+		t.Errorf("Expected \"sunset.jpg\", got %v, %v", actions, err)
+	}
+
+	// The original names are verified
+	old := a + " => old.txt\n" + b + " => old.txt\n"
+	invalidContents := []string{
+		"beach.jpg => sunset.jpg\nx => y.txt => y.txt\n" + old + "notes.txt\n",
+		"beach.jpeg => sunset.jpg\nx => y.txt => y.txt\n" + old + "notes.txt => notes.txt\n",
+		"beach.jpg => sunset.jpg\nx => y.txt => y.txt\n" + old + b + " => old.txt\n",
+		"beach.jpg => sunset.jpg\nx => y.txt => y.txt\n" + old,
+		"beach.jpg => \nx => y.txt => y.txt\n" + old + "notes.txt => notes.txt\n",
+		// The name alone is ambiguous
+		"beach.jpg => beach.jpg\nx => y.txt => y.txt\nold.txt => new.txt\n" + b + " => old.txt\nnotes.txt => notes.txt\n",
+	}
+
+	for _, content := range invalidContents {
+		_, err := fileActionsWithOptions(paths, content, FileActionOptions{TwoColumns: true})
+		if err == nil {
+			t.Errorf("Expected an error for \"%s\"", content)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ANSI_RESET = "\x1b[0m"
+	ANSI_RED   = "\x1b[31m"
+	ANSI_GREEN = "\x1b[32m"
+)
+
+const (
+	DIFF_EQUAL = iota
+	DIFF_REMOVED
+	DIFF_ADDED
+)
+
+const (
+	CONFIRM_YES  = "yes"
+	CONFIRM_NO   = "no"
+	CONFIRM_EDIT = "edit"
+)
+
+// Kept between the confirmations so that the input read in advance is not
+// lost when the file list is edited again. The terminal, which is read one
+// line at a time, is opened for each confirmation instead.
+var confirmationInput_ *bufio.Reader
+
+type diffSegment struct {
+	kind int
+	text string
+}
+
+// Returns the character-level differences between the two strings, based
+// on their longest common subsequence.
+func charDiff(oldText string, newText string) []diffSegment {
+	a := []rune(oldText)
+	b := []rune(newText)
+
+	// lengths[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	var output []diffSegment
+	add := func(kind int, r rune) {
+		if len(output) > 0 && output[len(output)-1].kind == kind {
+			output[len(output)-1].text += string(r)
+		} else {
+			output = append(output, diffSegment{kind, string(r)})
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			add(DIFF_EQUAL, a[i])
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && lengths[i+1][j] >= lengths[i][j+1]):
+			add(DIFF_REMOVED, a[i])
+			i++
+		default:
+			add(DIFF_ADDED, b[j])
+			j++
+		}
+	}
+
+	return output
+}
+
+// Returns the text of the segments of the given kind and the equal ones,
+// with the changed parts highlighted in the color if it is not empty, or
+// between brackets otherwise.
+func formatDiffSide(segments []diffSegment, kind int, color string) string {
+	output := ""
+	for _, segment := range segments {
+		switch segment.kind {
+		case DIFF_EQUAL:
+			output += segment.text
+		case kind:
+			if color != "" {
+				output += color + segment.text + ANSI_RESET
+			} else {
+				output += "[" + segment.text + "]"
+			}
+		}
+	}
+	return output
+}
+
+// Tells whether the preview can be colored, which is the case when the
+// output is a terminal and the NO_COLOR environment variable is not set.
+func colorOutputEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Returns one line per action, with the characters removed from the old
+// name and added to the new name highlighted.
+func fileActionsPreview(actions []*FileAction, useColor bool) string {
+	red := ""
+	green := ""
+	if useColor {
+		red = ANSI_RED
+		green = ANSI_GREEN
+	}
+
+	output := ""
+	for _, action := range actions {
+		// The directory of the file is shown on both sides, so that only
+		// the change to the name is highlighted.
+		oldName := filepath.Base(action.oldPath)
+		dir := strings.TrimSuffix(action.oldPath, oldName)
+
+		if isAttributeAction(action) {
+			output += "  " + dir + oldName + "  =>  " + green + attributeActionValue(action) + reset(useColor) + newline()
+			continue
+		}
+
+		if action.kind == KIND_DELETE {
+			if useColor {
+				output += "  " + dir + red + oldName + ANSI_RESET + "  =>  <Deleted>" + newline()
+			} else {
+				output += "  " + dir + oldName + "  =>  <Deleted>" + newline()
+			}
+			continue
+		}
+
+		segments := charDiff(oldName, action.newPath)
+		output += "  " + dir + formatDiffSide(segments, DIFF_REMOVED, red) + "  =>  " + dir + formatDiffSide(segments, DIFF_ADDED, green) + newline()
+	}
+	return output
+}
+
+func reset(useColor bool) string {
+	if useColor {
+		return ANSI_RESET
+	}
+	return ""
+}
+
+func pluralize(count int, singular string, plural string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
+
+// Returns eg. "3 renames, 1 delete, 0 directory moves". A directory move is
+// a rename that puts the file in another directory. The changes of mtime or
+// mode are only counted if there are any.
+func fileActionsSummary(actions []*FileAction) string {
+	renameCount := 0
+	deleteCount := 0
+	moveCount := 0
+	attributeCount := 0
+	for _, action := range actions {
+		if isAttributeAction(action) {
+			attributeCount++
+		} else if action.kind == KIND_DELETE {
+			deleteCount++
+		} else if filepath.Dir(action.FullOldPath()) != filepath.Dir(action.FullNewPath()) {
+			moveCount++
+		} else {
+			renameCount++
+		}
+	}
+
+	output := pluralize(renameCount, "rename", "renames") + ", " + pluralize(deleteCount, "delete", "deletes") + ", " + pluralize(moveCount, "directory move", "directory moves")
+	if attributeCount > 0 {
+		output += ", " + pluralize(attributeCount, "attribute change", "attribute changes")
+	}
+	return output
+}
+
+// Asks whether the changes should be applied, until a valid answer is
+// given. The operation is cancelled if there is nothing more to read.
+// Editing again is only offered if canEdit is true.
+func askConfirmation(reader *bufio.Reader, writer io.Writer, canEdit bool) (string, error) {
+	prompt := "Apply these changes? [y]es, [n]o: "
+	if canEdit {
+		prompt = "Apply these changes? [y]es, [n]o, [e]dit again: "
+	}
+
+	for {
+		fmt.Fprint(writer, prompt)
+		line, err := reader.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+
+		switch answer {
+		case "y", "yes":
+			return CONFIRM_YES, nil
+		case "n", "no":
+			return CONFIRM_NO, nil
+		case "e", "edit":
+			if canEdit {
+				return CONFIRM_EDIT, nil
+			}
+		}
+
+		if err == io.EOF {
+			fmt.Fprintln(writer)
+			return CONFIRM_NO, nil
+		}
+		if err != nil {
+			return CONFIRM_NO, err
+		}
+	}
+}
+
+// Shows the changes and asks whether they should be applied.
+func confirmFileActions(actions []*FileAction, canEdit bool) (string, error) {
+	fmt.Print(fileActionsPreview(actions, colorOutputEnabled()))
+	logInfo("%s.", fileActionsSummary(actions))
+
+	if stdinConsumed_ {
+		terminal, err := openTerminal()
+		if err != nil {
+			return CONFIRM_NO, err
+		}
+		defer terminal.Close()
+		return askConfirmation(bufio.NewReader(terminal), os.Stdout, canEdit)
+	}
+
+	if confirmationInput_ == nil {
+		confirmationInput_ = bufio.NewReader(os.Stdin)
+	}
+
+	return askConfirmation(confirmationInput_, os.Stdout, canEdit)
+}
+
+// Same as confirmFileActions(), for when the file list cannot be edited
+// again. Returns whether the changes should be applied.
+func confirmFileActionsOnce(actions []*FileAction) (bool, error) {
+	if len(actions) == 0 {
+		return true, nil
+	}
+
+	answer, err := confirmFileActions(actions, false)
+	if err != nil {
+		return false, err
+	}
+
+	if answer != CONFIRM_YES {
+		logInfo("The operation has been cancelled. No file has been renamed.")
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_charDiff(t *testing.T) {
+	testCases := [][]string{
+		// old, new, old side, new side
+		{"IMG_001.jpg", "beach_001.jpg", "[IMG]_001.jpg", "[beach]_001.jpg"},
+		{"abc", "abc", "abc", "abc"},
+		{"", "new", "", "[new]"},
+		{"old", "", "[old]", ""},
+		{"café.txt", "cafe.txt", "caf[é].txt", "caf[e].txt"},
+	}
+
+	for _, testCase := range testCases {
+		segments := charDiff(testCase[0], testCase[1])
+		oldSide := formatDiffSide(segments, DIFF_REMOVED, "")
+		newSide := formatDiffSide(segments, DIFF_ADDED, "")
+		if oldSide != testCase[2] || newSide != testCase[3] {
+			t.Errorf("\"%s\" => \"%s\": expected \"%s\" and \"%s\", got \"%s\" and \"%s\"", testCase[0], testCase[1], testCase[2], testCase[3], oldSide, newSide)
+		}
+	}
+}
+
+func Test_fileActionsPreview(t *testing.T) {
+	newline_ = "\n"
+
+	rename := NewFileAction()
+	rename.oldPath = "photos/IMG_1.jpg"
+	rename.newPath = "beach_1.jpg"
+
+	move := NewFileAction()
+	move.oldPath = "photos/IMG_2.jpg"
+	move.newPath = "2015/IMG_2.jpg"
+
+	del := NewFileAction()
+	del.kind = KIND_DELETE
+	del.oldPath = "photos/IMG_3.jpg"
+
+	actions := []*FileAction{rename, move, del}
+
+	expected := "  photos/[IMG]_1.jpg  =>  photos/[beach]_1.jpg\n  photos/IMG_2.jpg  =>  photos/[2015/]IMG_2.jpg\n  photos/IMG_3.jpg  =>  <Deleted>\n"
+	if actual := fileActionsPreview(actions, false); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+
+	if actual := fileActionsPreview(actions[:1], true); actual != "  photos/"+ANSI_RED+"IMG"+ANSI_RESET+"_1.jpg  =>  photos/"+ANSI_GREEN+"beach"+ANSI_RESET+"_1.jpg\n" {
+		t.Errorf("Unexpected colored preview: %q", actual)
+	}
+
+	expected = "1 rename, 1 delete, 1 directory move"
+	if actual := fileActionsSummary(actions); actual != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, actual)
+	}
+}
+
+func Test_askConfirmation(t *testing.T) {
+	testCases := map[string]string{
+		"y\n":             CONFIRM_YES,
+		"YES\n":           CONFIRM_YES,
+		"n\n":             CONFIRM_NO,
+		"maybe\n\nedit\n": CONFIRM_EDIT,
+		"e":               CONFIRM_EDIT,
+		"":                CONFIRM_NO,
+		"maybe":           CONFIRM_NO,
+	}
+
+	for input, expected := range testCases {
+		var output bytes.Buffer
+		answer, err := askConfirmation(bufio.NewReader(strings.NewReader(input)), &output, true)
+		if err != nil {
+			t.Errorf("%q: expected no error, got %s", input, err)
+		}
+		if answer != expected {
+			t.Errorf("%q: expected \"%s\", got \"%s\"", input, expected, answer)
+		}
+	}
+
+	// Editing again is not offered when the file list cannot be edited
+	var output bytes.Buffer
+	answer, err := askConfirmation(bufio.NewReader(strings.NewReader("e\ny\n")), &output, false)
+	if err != nil || answer != CONFIRM_YES {
+		t.Errorf("Expected \"%s\", got \"%s\", %v", CONFIRM_YES, answer, err)
+	}
+	if strings.Contains(output.String(), "[e]dit") {
+		t.Errorf("Unexpected prompt: %q", output.String())
+	}
+}
@@ -35,9 +35,16 @@ func profileOpen() error {
 		return errors.New(fmt.Sprintf("History table could not be created: %s", err))
 	}
 
+	// Columns added in later versions. Errors are ignored since there will be
+	// one if the column already exists.
+	for _, column := range []string{"operation_id TEXT", "username TEXT", "host TEXT", "cwd TEXT", "kind INTEGER", "previous_value TEXT", "value TEXT", "imported INTEGER"} {
+		profileDb_.Exec("ALTER TABLE history ADD COLUMN " + column)
+	}
+
 	profileDb_.Exec("CREATE INDEX id_index ON history (id)")
 	profileDb_.Exec("CREATE INDEX destination_index ON history (destination)")
 	profileDb_.Exec("CREATE INDEX timestamp_index ON history (timestamp)")
+	profileDb_.Exec("CREATE INDEX operation_id_index ON history (operation_id)")
 
 	config_ = sqlkv.New(profileDb_, "config")
 
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/nu7hatch/gouuid"
+)
+
+var errRenameNotSupported = errors.New("rename operation is not supported on this file system")
+
+// Renames oldPath to newPath, but fails with an error matching os.ErrExist
+// if newPath already exists. On systems that support it, the check and the
+// rename are done in one atomic operation, so that a file created in the
+// meantime by another process cannot be overwritten.
+func renameNoReplace(oldPath string, newPath string) error {
+	err := renameNoReplaceAtomic(oldPath, newPath)
+	if err != errRenameNotSupported {
+		return err
+	}
+
+	if _, err := os.Lstat(newPath); err == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+
+	return os.Rename(oldPath, newPath)
+}
+
+// Atomically swaps path1 and path2. Returns errRenameNotSupported if this is
+// not possible on the current system, in which case the caller should go
+// through an intermediate name instead.
+func renameExchange(path1 string, path2 string) error {
+	return renameExchangeAtomic(path1, path2)
+}
+
+type renameStep struct {
+	oldPath      string
+	newPath      string
+	exchange     bool          // Swap oldPath and newPath
+	intermediate bool          // Rename to a temporary name - the action is not complete yet
+	actions      []*FileAction // For exchanges, the second action goes from newPath to oldPath
+}
+
+func newRenameStep(oldPath string, newPath string, action *FileAction) renameStep {
+	return renameStep{
+		oldPath: oldPath,
+		newPath: newPath,
+		actions: []*FileAction{action},
+	}
+}
+
+// Returns the paths the step moves the action from and to.
+func (this renameStep) actionPaths(index int) (string, string) {
+	if index == 0 {
+		return this.oldPath, this.newPath
+	}
+	return this.newPath, this.oldPath
+}
+
+// Returns the steps needed to perform the rename actions. Each action
+// depends on at most one other action - the one that moves its destination
+// away - so the actions form chains (a => b, b => c, c => d) and cycles
+// (a => b, b => a). Chains are done in order starting from their free
+// destination ("c" is renamed first), and only cycles need a temporary name.
+// Cycles of two files are swapped in one step.
+func renameSteps(actions []*FileAction) []renameStep {
+	var output []renameStep
+
+	byOldPath := make(map[string]*FileAction)
+	byNewPath := make(map[string]*FileAction)
+	for _, action := range actions {
+		byOldPath[action.FullOldPath()] = action
+		byNewPath[action.FullNewPath()] = action
+	}
+
+	done := make(map[*FileAction]bool)
+
+	// Adds the action, then the action that was waiting for it to move away,
+	// and so on.
+	addChain := func(action *FileAction) {
+		for action != nil && !done[action] {
+			output = append(output, newRenameStep(action.FullOldPath(), action.FullNewPath(), action))
+			done[action] = true
+			action = byNewPath[action.FullOldPath()]
+		}
+	}
+
+	for _, action := range actions {
+		dependency := byOldPath[action.FullNewPath()]
+		if dependency == nil || dependency == action {
+			addChain(action)
+		}
+	}
+
+	// Whatever is left is part of a cycle.
+	for _, action := range actions {
+		if done[action] {
+			continue
+		}
+
+		next := byOldPath[action.FullNewPath()]
+		if byOldPath[next.FullNewPath()] == action {
+			output = append(output, renameStep{
+				oldPath:  action.FullOldPath(),
+				newPath:  next.FullOldPath(),
+				exchange: true,
+				actions:  []*FileAction{action, next},
+			})
+			done[action] = true
+			done[next] = true
+			continue
+		}
+
+		u, _ := uuid.NewV4()
+		action.intermediatePath = action.FullNewPath() + "-" + u.String()
+		step := newRenameStep(action.FullOldPath(), action.intermediatePath, action)
+		step.intermediate = true
+		output = append(output, step)
+		done[action] = true
+		addChain(byNewPath[action.FullOldPath()])
+		output = append(output, newRenameStep(action.intermediatePath, action.FullNewPath(), action))
+	}
+
+	return output
+}
+
+// Swaps the two files using a temporary name, for when they cannot be
+// exchanged in one operation.
+func swapFiles(path1 string, path2 string) error {
+	u, _ := uuid.NewV4()
+	intermediatePath := path2 + "-" + u.String()
+
+	err := moveFile(path1, intermediatePath)
+	if err != nil {
+		return err
+	}
+
+	err = moveFile(path2, path1)
+	if err != nil {
+		return err
+	}
+
+	return moveFile(intermediatePath, path2)
+}
+
+func processRenameStep(step renameStep) error {
+	if step.exchange {
+		err := renameExchange(step.oldPath, step.newPath)
+		if err == errRenameNotSupported || errors.Is(err, syscall.EXDEV) {
+			return swapFiles(step.oldPath, step.newPath)
+		}
+		return err
+	}
+
+	os.MkdirAll(filepath.Dir(step.newPath), 0755)
+
+	err := moveFile(step.oldPath, step.newPath)
+	if !errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	// The destination can exist if it is in fact the same file as the source
+	// (eg. "abcd" renamed to "ABCD" on a case insensitive file system), in
+	// which case it needs to go through a temporary name. Otherwise it has
+	// most likely been created by another process after fileActions() has
+	// checked the destinations.
+	fileInfo1, err1 := os.Stat(step.oldPath)
+	fileInfo2, err2 := os.Stat(step.newPath)
+	if err1 != nil || err2 != nil || !os.SameFile(fileInfo1, fileInfo2) {
+		return errors.New(fmt.Sprintf("\"%s\" cannot be renamed to \"%s\": destination already exists", step.oldPath, step.newPath))
+	}
+
+	u, _ := uuid.NewV4()
+	intermediatePath := step.newPath + "-" + u.String()
+
+	err = renameNoReplace(step.oldPath, intermediatePath)
+	if err != nil {
+		return err
+	}
+
+	return renameNoReplace(intermediatePath, step.newPath)
+}
+
+// Returns the path with the oldDir prefix replaced by newDir, if the path is
+// inside oldDir.
+func replacePathPrefix(path string, oldDir string, newDir string) (string, bool) {
+	if !pathIsUnder(path, oldDir) {
+		return path, false
+	}
+	return newDir + path[len(oldDir):], true
+}
+
+// Once a directory has been moved, the paths of the files inside it have
+// changed. This updates the remaining steps accordingly, so that a directory
+// and its content can be renamed in the same operation.
+func updateMovedPaths(steps []renameStep, done renameStep) {
+	update := func(path string) string {
+		if p, ok := replacePathPrefix(path, done.oldPath, done.newPath); ok {
+			return p
+		}
+		if done.exchange {
+			p, _ := replacePathPrefix(path, done.newPath, done.oldPath)
+			return p
+		}
+		return path
+	}
+
+	for i := range steps {
+		steps[i].oldPath = update(steps[i].oldPath)
+		steps[i].newPath = update(steps[i].newPath)
+	}
+}
+
+// Processes the steps and returns the actions that have been completed. The
+// paths of these actions are updated to where the files actually were
+// before and after being renamed, which is what needs to be saved in the
+// history.
+func processRenameSteps(steps []renameStep) ([]*FileAction, error) {
+	var output []*FileAction
+	sourcePaths := make(map[*FileAction]string)
+
+	for i, step := range steps {
+		for j, action := range step.actions {
+			if _, ok := sourcePaths[action]; !ok {
+				sourcePaths[action], _ = step.actionPaths(j)
+			}
+		}
+
+		err := processRenameStep(step)
+		if err != nil {
+			return output, err
+		}
+
+		updateMovedPaths(steps[i+1:], step)
+
+		if step.intermediate {
+			continue
+		}
+
+		for j, action := range step.actions {
+			_, newPath := step.actionPaths(j)
+			action.setFullPaths(sourcePaths[action], newPath)
+			output = append(output, action)
+		}
+	}
+
+	return output, nil
+}
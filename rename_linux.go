@@ -0,0 +1,32 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func renameat2(oldPath string, newPath string, flags uint) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, flags)
+	if err == nil {
+		return nil
+	}
+
+	// ENOSYS: kernel older than 3.15. EINVAL: file system that does not
+	// support the flags (or invalid paths, which the fallback will report).
+	if err == unix.ENOSYS || err == unix.EINVAL {
+		return errRenameNotSupported
+	}
+
+	return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+}
+
+func renameNoReplaceAtomic(oldPath string, newPath string) error {
+	return renameat2(oldPath, newPath, unix.RENAME_NOREPLACE)
+}
+
+func renameExchangeAtomic(path1 string, path2 string) error {
+	return renameat2(path1, path2, unix.RENAME_EXCHANGE)
+}
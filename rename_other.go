@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+func renameNoReplaceAtomic(oldPath string, newPath string) error {
+	return errRenameNotSupported
+}
+
+func renameExchangeAtomic(path1 string, path2 string) error {
+	return errRenameNotSupported
+}
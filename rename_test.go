@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_renameNoReplace(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	p0 := filepath.Join(tempFolder(), "0")
+	p1 := filepath.Join(tempFolder(), "1")
+	p2 := filepath.Join(tempFolder(), "2")
+
+	filePutContent(p0, "0")
+	filePutContent(p1, "1")
+
+	err := renameNoReplace(p0, p1)
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected os.ErrExist, got %v", err)
+	}
+
+	if fileGetContent(p1) != "1" {
+		t.Error("Destination has been overwritten")
+	}
+
+	err = renameNoReplace(p0, p2)
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	if fileExists(p0) || fileGetContent(p2) != "0" {
+		t.Error("File has not been renamed")
+	}
+}
+
+func Test_renameExchange(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	p0 := filepath.Join(tempFolder(), "0")
+	p1 := filepath.Join(tempFolder(), "1")
+
+	filePutContent(p0, "0")
+	filePutContent(p1, "1")
+
+	err := renameExchange(p0, p1)
+	if err == errRenameNotSupported {
+		t.Skip("Exchange is not supported on this system")
+	}
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if fileGetContent(p0) != "1" || fileGetContent(p1) != "0" {
+		t.Error("Files have not been swapped")
+	}
+}
+
+func newTestRenameActions(paths ...string) []*FileAction {
+	var output []*FileAction
+	for i := 0; i < len(paths); i += 2 {
+		action := NewFileAction()
+		action.oldPath = paths[i]
+		action.newPath = paths[i+1]
+		output = append(output, action)
+	}
+	return output
+}
+
+func Test_renameSteps(t *testing.T) {
+	// Chain: only needs to be done in the right order
+	steps := renameSteps(newTestRenameActions("a", "b", "b", "c", "c", "d"))
+	if len(steps) != 3 {
+		t.Fatalf("Expected 3 steps, got %d", len(steps))
+	}
+
+	for i, expected := range []string{"c", "b", "a"} {
+		if filepath.Base(steps[i].oldPath) != expected || len(steps[i].actions) != 1 {
+			t.Errorf("Step %d: expected \"%s\", got \"%s\"", i, expected, steps[i].oldPath)
+		}
+	}
+
+	// Swap: done in one step
+	steps = renameSteps(newTestRenameActions("a", "b", "b", "a"))
+	if len(steps) != 1 || !steps[0].exchange || len(steps[0].actions) != 2 {
+		t.Errorf("Expected one exchange step, got %v", steps)
+	}
+
+	// Cycle: one file goes through a temporary name
+	steps = renameSteps(newTestRenameActions("a", "b", "b", "c", "c", "a", "x", "y"))
+	if len(steps) != 5 {
+		t.Fatalf("Expected 5 steps, got %d", len(steps))
+	}
+
+	intermediateCount := 0
+	actionCount := 0
+	for _, step := range steps {
+		if step.exchange {
+			t.Error("Unexpected exchange step")
+		}
+		if step.intermediate {
+			intermediateCount++
+		} else {
+			actionCount += len(step.actions)
+		}
+	}
+
+	if intermediateCount != 1 || actionCount != 4 {
+		t.Errorf("Expected 1 intermediate name and 4 actions, got %d and %d", intermediateCount, actionCount)
+	}
+}
+
+func Test_processFileActions_chainAndCycle(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	var paths []string
+	for i := 0; i < 7; i++ {
+		p := filepath.Join(tempFolder(), fmt.Sprintf("%d", i))
+		filePutContent(p, fmt.Sprintf("%d", i))
+		paths = append(paths, p)
+	}
+
+	// 0 => 1 => 2 => 3 (new file), and 4 => 5 => 6 => 4
+	fileActions := newTestRenameActions(
+		paths[0], "1",
+		paths[1], "2",
+		paths[2], "3",
+		paths[4], "5",
+		paths[5], "6",
+		paths[6], "4",
+	)
+	os.Remove(paths[3])
+
+	err := processFileActions(fileActions, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	expected := []string{"", "0", "1", "2", "6", "4", "5"}
+	for i, content := range expected {
+		if fileGetContent(paths[i]) != content {
+			t.Errorf("File %d: expected \"%s\", got \"%s\"", i, content, fileGetContent(paths[i]))
+		}
+	}
+
+	tempFiles, _ := filepath.Glob(filepath.Join(tempFolder(), "*-*"))
+	if len(tempFiles) > 0 {
+		t.Errorf("Intermediate files have not been renamed: %v", tempFiles)
+	}
+
+	items, _ := allHistoryItems()
+	if len(items) != 6 {
+		t.Errorf("Expected 6 history items, got %d", len(items))
+	}
+}
+
+func Test_updateMovedPaths(t *testing.T) {
+	p := filepath.FromSlash
+
+	steps := []renameStep{
+		{oldPath: p("/x/a"), newPath: p("/x/b")},
+		{oldPath: p("/y/a"), newPath: p("/y/b")},
+		{oldPath: p("/xy"), newPath: p("/x")},
+	}
+
+	updateMovedPaths(steps, renameStep{oldPath: p("/x"), newPath: p("/y"), exchange: true})
+
+	expected := []string{"/y/a", "/y/b", "/x/a", "/x/b", "/xy", "/x"}
+	for i, step := range steps {
+		if step.oldPath != p(expected[i*2]) || step.newPath != p(expected[i*2+1]) {
+			t.Errorf("Expected %s => %s, got %s => %s", expected[i*2], expected[i*2+1], step.oldPath, step.newPath)
+		}
+	}
+}
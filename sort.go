@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SORT_NAME    = "name"
+	SORT_NATURAL = "natural"
+	SORT_MTIME   = "mtime"
+	SORT_CTIME   = "ctime"
+	SORT_SIZE    = "size"
+	SORT_EXT     = "ext"
+)
+
+// Splits the string into runs of digits and runs of other characters.
+func naturalChunks(s string) []string {
+	var output []string
+	current := ""
+	for _, c := range s {
+		if current != "" && isDigit(c) != isDigit(rune(current[len(current)-1])) {
+			output = append(output, current)
+			current = ""
+		}
+		current += string(c)
+	}
+	if current != "" {
+		output = append(output, current)
+	}
+	return output
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Compares the strings so that "file2" comes before "file10". Text is
+// compared case-insensitively and numbers by value. Returns -1, 0 or 1.
+func naturalCompare(s1 string, s2 string) int {
+	chunks1 := naturalChunks(s1)
+	chunks2 := naturalChunks(s2)
+
+	for i := 0; i < len(chunks1) && i < len(chunks2); i++ {
+		c1 := chunks1[i]
+		c2 := chunks2[i]
+
+		if isDigit(rune(c1[0])) && isDigit(rune(c2[0])) {
+			n1 := strings.TrimLeft(c1, "0")
+			n2 := strings.TrimLeft(c2, "0")
+			if len(n1) != len(n2) {
+				return compareInts(len(n1), len(n2))
+			}
+			if n1 != n2 {
+				return strings.Compare(n1, n2)
+			}
+			continue
+		}
+
+		if r := strings.Compare(strings.ToLower(c1), strings.ToLower(c2)); r != 0 {
+			return r
+		}
+	}
+
+	if len(chunks1) != len(chunks2) {
+		return compareInts(len(chunks1), len(chunks2))
+	}
+
+	// Same text apart from case and leading zeros
+	return strings.Compare(s1, s2)
+}
+
+func compareInts(i1 int, i2 int) int {
+	if i1 < i2 {
+		return -1
+	}
+	if i1 > i2 {
+		return 1
+	}
+	return 0
+}
+
+func compareTimes(t1 time.Time, t2 time.Time) int {
+	if t1.Before(t2) {
+		return -1
+	}
+	if t1.After(t2) {
+		return 1
+	}
+	return 0
+}
+
+// Sorts the file paths in place. The files that cannot be stat'ed are
+// sorted as if they were empty and dated from 1970. Ties are sorted by
+// natural order.
+func sortFilePaths(filePaths []string, order string, reverse bool) error {
+	var infos map[string]os.FileInfo
+	info := func(path string) os.FileInfo {
+		if infos == nil {
+			infos = make(map[string]os.FileInfo)
+			for _, p := range filePaths {
+				if fi, err := os.Stat(p); err == nil {
+					infos[p] = fi
+				}
+			}
+		}
+		return infos[path]
+	}
+
+	var compare func(p1 string, p2 string) int
+
+	switch strings.ToLower(order) {
+
+	case "", SORT_NAME:
+
+		compare = strings.Compare
+
+	case SORT_NATURAL:
+
+		compare = naturalCompare
+
+	case SORT_MTIME, SORT_CTIME:
+
+		fileTime := func(path string) time.Time {
+			fi := info(path)
+			if fi == nil {
+				return time.Unix(0, 0)
+			}
+			if strings.ToLower(order) == SORT_CTIME {
+				return fileChangeTime(fi)
+			}
+			return fi.ModTime()
+		}
+
+		compare = func(p1 string, p2 string) int {
+			if r := compareTimes(fileTime(p1), fileTime(p2)); r != 0 {
+				return r
+			}
+			return naturalCompare(p1, p2)
+		}
+
+	case SORT_SIZE:
+
+		fileSize := func(path string) int64 {
+			if fi := info(path); fi != nil {
+				return fi.Size()
+			}
+			return 0
+		}
+
+		compare = func(p1 string, p2 string) int {
+			s1 := fileSize(p1)
+			s2 := fileSize(p2)
+			if s1 != s2 {
+				if s1 < s2 {
+					return -1
+				}
+				return 1
+			}
+			return naturalCompare(p1, p2)
+		}
+
+	case SORT_EXT:
+
+		compare = func(p1 string, p2 string) int {
+			if r := strings.Compare(strings.ToLower(fileExtension(p1)), strings.ToLower(fileExtension(p2))); r != 0 {
+				return r
+			}
+			return naturalCompare(p1, p2)
+		}
+
+	default:
+
+		return errors.New(fmt.Sprintf("unknown sort order: \"%s\". Possible values: name, natural, mtime, ctime, size, ext", order))
+
+	}
+
+	sort.SliceStable(filePaths, func(i, j int) bool {
+		if reverse {
+			return compare(filePaths[j], filePaths[i]) < 0
+		}
+		return compare(filePaths[i], filePaths[j]) < 0
+	})
+
+	return nil
+}
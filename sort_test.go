@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_naturalCompare(t *testing.T) {
+	testCases := []struct {
+		s1       string
+		s2       string
+		expected int
+	}{
+		{"file2", "file10", -1},
+		{"file10", "file2", 1},
+		{"file2", "file2", 0},
+		{"File2", "file10", -1},
+		{"file02", "file2", -1},
+		{"a", "a1", -1},
+		{"img9.jpg", "img10.jpg", -1},
+		{"10", "9a", 1},
+	}
+
+	for _, testCase := range testCases {
+		actual := naturalCompare(testCase.s1, testCase.s2)
+		if actual != testCase.expected {
+			t.Errorf("\"%s\" / \"%s\": expected %d, got %d", testCase.s1, testCase.s2, testCase.expected, actual)
+		}
+	}
+}
+
+func Test_sortFilePaths(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	now := time.Now()
+	var paths []string
+	for i, name := range []string{"file10.txt", "file2.jpg", "file1.png"} {
+		path := filepath.Join(tempFolder(), name)
+		os.WriteFile(path, []byte(strings.Repeat("x", 10-i)), 0700)
+		mtime := now.Add(time.Duration(-i) * time.Hour)
+		os.Chtimes(path, mtime, mtime)
+		paths = append(paths, path)
+	}
+
+	testCases := []struct {
+		order    string
+		reverse  bool
+		expected string
+	}{
+		{"name", false, "file1.png,file10.txt,file2.jpg"},
+		{"natural", false, "file1.png,file2.jpg,file10.txt"},
+		{"natural", true, "file10.txt,file2.jpg,file1.png"},
+		{"mtime", false, "file1.png,file2.jpg,file10.txt"},
+		{"size", false, "file1.png,file2.jpg,file10.txt"},
+		{"size", true, "file10.txt,file2.jpg,file1.png"},
+		{"ext", false, "file2.jpg,file1.png,file10.txt"},
+		{"", false, "file1.png,file10.txt,file2.jpg"},
+	}
+
+	for _, testCase := range testCases {
+		err := sortFilePaths(paths, testCase.order, testCase.reverse)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		var names []string
+		for _, path := range paths {
+			names = append(names, filepath.Base(path))
+		}
+
+		if strings.Join(names, ",") != testCase.expected {
+			t.Errorf("%s: expected %s, got %s", testCase.order, testCase.expected, strings.Join(names, ","))
+		}
+	}
+
+	err := sortFilePaths(paths, "random", false)
+	if err == nil {
+		t.Error("Expected an error, got nil")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errTerminalNotSupported = errors.New("the built-in editor is not supported on this platform")
+
+func makeTerminalRaw(terminal *os.File) (func(), error) {
+	return nil, errTerminalNotSupported
+}
+
+func terminalSize(terminal *os.File) (int, int, error) {
+	return 0, 0, errTerminalNotSupported
+}
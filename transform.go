@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type filenameTransform func(string) string
+
+// Letters that are not decomposed into an ASCII letter and a diacritic by
+// Unicode normalization.
+var asciiTransliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "Th", 'ł': "l",
+	'Ł': "L", 'ı': "i", 'ħ': "h", 'Ħ': "H", 'ŀ': "l", 'Ŀ': "L", 'ŋ': "ng",
+	'Ŋ': "NG", 'ſ': "s", '‘': "'", '’': "'", '“': "\"", '”': "\"", '–': "-",
+	'—': "-", '…': "...", '«': "\"", '»': "\"",
+}
+
+// Replaces the non-ASCII characters with their closest ASCII equivalent,
+// or removes them if there is none.
+func transliterateToAscii(s string) string {
+	output := ""
+	for _, c := range norm.NFD.String(s) {
+		if c <= unicode.MaxASCII {
+			output += string(c)
+			continue
+		}
+		if unicode.Is(unicode.Mn, c) {
+			continue
+		}
+		if t, ok := asciiTransliterations[c]; ok {
+			output += t
+			continue
+		}
+		if unicode.IsSpace(c) {
+			output += " "
+		}
+	}
+	return output
+}
+
+func slugify(s string) string {
+	output := ""
+	for _, c := range strings.ToLower(transliterateToAscii(s)) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			output += string(c)
+		} else if !strings.HasSuffix(output, "-") {
+			output += "-"
+		}
+	}
+	return strings.Trim(output, "-")
+}
+
+func titleCase(s string) string {
+	output := ""
+	previous := ' '
+	for _, c := range s {
+		if unicode.IsLetter(previous) || unicode.IsDigit(previous) || previous == '\'' {
+			output += string(unicode.ToLower(c))
+		} else {
+			output += string(unicode.ToUpper(c))
+		}
+		previous = c
+	}
+	return output
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Replaces each run of spaces, underscores and hyphens with the separator.
+func replaceSeparators(s string, separator string) string {
+	words := strings.FieldsFunc(s, func(c rune) bool {
+		return unicode.IsSpace(c) || c == '_' || c == '-'
+	})
+	return strings.Join(words, separator)
+}
+
+func filenameTransformByName(spec string) (filenameTransform, error) {
+	name := spec
+	arg := ""
+	if index := strings.Index(spec, ":"); index >= 0 {
+		name = spec[:index]
+		arg = spec[index+1:]
+	}
+
+	switch strings.ToLower(name) {
+	case "ascii":
+		return transliterateToAscii, nil
+	case "slugify":
+		return slugify, nil
+	case "lower":
+		return strings.ToLower, nil
+	case "upper":
+		return strings.ToUpper, nil
+	case "title":
+		return titleCase, nil
+	case "collapse-spaces":
+		return collapseSpaces, nil
+	case "separator":
+		if arg == "" {
+			return nil, errors.New("the separator transform requires a separator. eg. separator:_")
+		}
+		return func(s string) string { return replaceSeparators(s, arg) }, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown transform: \"%s\". Possible values: ascii, slugify, lower, upper, title, collapse-spaces, separator:<separator>", spec))
+}
+
+// Returns a transform that applies all the specified transforms in order.
+// If keepExtension is true, the extension is not transformed.
+func parseFilenameTransforms(specs []string, keepExtension bool) (filenameTransform, error) {
+	var transforms []filenameTransform
+	for _, spec := range specs {
+		t, err := filenameTransformByName(spec)
+		if err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, t)
+	}
+
+	return func(name string) string {
+		ext := ""
+		if keepExtension {
+			ext = filepath.Ext(name)
+			name = name[:len(name)-len(ext)]
+		}
+
+		for _, t := range transforms {
+			name = t(name)
+		}
+
+		if name == "" {
+			// Don't leave a file without a name (eg. "漢字.txt" in ASCII)
+			return ""
+		}
+
+		return name + ext
+	}, nil
+}
+
+// Returns the base names of the files, transformed. The names that would
+// be empty once transformed are left unchanged.
+func transformedFilenames(filePaths []string, transform filenameTransform) []string {
+	var output []string
+	for _, filePath := range filePaths {
+		name := filepath.Base(filePath)
+		if transform != nil {
+			if n := transform(name); n != "" {
+				name = n
+			}
+		}
+		output = append(output, name)
+	}
+	return output
+}
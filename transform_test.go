@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_parseFilenameTransforms(t *testing.T) {
+	type TestCase struct {
+		specs         []string
+		keepExtension bool
+		input         string
+		expected      string
+	}
+
+	var testCases = []TestCase{
+		{[]string{"slugify"}, true, "Café Déjà Vu (Live).mp3", "cafe-deja-vu-live.mp3"},
+		{[]string{"slugify"}, false, "Song.MP3", "song-mp3"},
+		{[]string{"ascii"}, true, "Straße Ærø.txt", "Strasse AEro.txt"},
+		{[]string{"lower"}, true, "HELLO World.JPG", "hello world.JPG"},
+		{[]string{"lower"}, false, "HELLO World.JPG", "hello world.jpg"},
+		{[]string{"upper"}, true, "hello.txt", "HELLO.txt"},
+		{[]string{"title"}, true, "the QUICK brown fox's den.txt", "The Quick Brown Fox's Den.txt"},
+		{[]string{"collapse-spaces"}, true, "  a   b  c .txt", "a b c.txt"},
+		{[]string{"separator:_"}, true, "a b-c__d.txt", "a_b_c_d.txt"},
+		{[]string{"ascii", "lower", "separator:."}, true, "Été Chaud.txt", "ete.chaud.txt"},
+		{[]string{"ascii"}, true, "漢字.txt", ""},
+		{[]string{}, true, "unchanged.txt", "unchanged.txt"},
+	}
+
+	for _, testCase := range testCases {
+		transform, err := parseFilenameTransforms(testCase.specs, testCase.keepExtension)
+		if err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		actual := transform(testCase.input)
+		if actual != testCase.expected {
+			t.Errorf("%v: expected \"%s\", got \"%s\"", testCase.specs, testCase.expected, actual)
+		}
+	}
+
+	for _, spec := range []string{"nope", "separator", "separator:"} {
+		_, err := parseFilenameTransforms([]string{spec}, true)
+		if err == nil {
+			t.Errorf("Expected an error for \"%s\"", spec)
+		}
+	}
+}
+
+func Test_createListFileContentWithOptions_transform(t *testing.T) {
+	newline_ = "\n"
+
+	transform, _ := parseFilenameTransforms([]string{"ascii"}, true)
+	content := createListFileContentWithOptions([]string{"/tmp/Café.txt", "/tmp/漢字.txt"}, ListFileOptions{Transform: transform})
+
+	// Names that would be empty once transformed are left unchanged
+	expected := "Cafe.txt\n漢字.txt\n"
+	if content != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, content)
+	}
+
+	actions, err := fileActions([]string{"/tmp/Café.txt", "/tmp/漢字.txt"}, content)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if len(actions) != 1 || actions[0].newPath != "Cafe.txt" {
+		t.Errorf("Unexpected actions: %v", actions)
+	}
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// The built-in editor is a full-screen terminal UI that shows the original
+// names and the new names side by side. It is used with --tui, or when no
+// external editor can be found. It produces the same content as the file
+// buffer, which is then processed by fileActions().
+
+const (
+	TUI_MODE_NORMAL = iota
+	TUI_MODE_EDIT
+	TUI_MODE_SEARCH
+)
+
+const TUI_HELP = "Enter:edit Space/v:select d:delete u:revert /:search Ctrl+S:apply q:cancel"
+
+type tuiEditor struct {
+	filePaths   []string
+	oldNames    []string
+	newNames    []string
+	deleted     []bool
+	selected    []bool
+	anchor      int // First line of the range being selected with "v", or -1
+	cursor      int
+	top         int // First visible line
+	mode        int
+	input       []rune // Text being typed in edit and search modes
+	inputPos    int
+	search      string
+	message     string
+	confirmQuit bool
+	options     FileActionOptions
+	conflicts   map[int]string // Problems of the lines that cannot be applied
+	problem     string         // Problem that is not about a specific line
+}
+
+func newTuiEditor(filePaths []string, newNames []string, options FileActionOptions) *tuiEditor {
+	output := &tuiEditor{
+		filePaths: filePaths,
+		newNames:  append([]string{}, newNames...),
+		deleted:   make([]bool, len(filePaths)),
+		selected:  make([]bool, len(filePaths)),
+		anchor:    -1,
+		options:   options,
+	}
+
+	for _, filePath := range filePaths {
+		output.oldNames = append(output.oldNames, filepath.Base(filePath))
+	}
+
+	// The buffer lines are matched to the files by position
+	output.options.LockExtensions = false
+	output.options.SkipConflictChecks = true
+
+	output.check()
+	return output
+}
+
+// Returns the content of the file buffer matching the changes.
+func (this *tuiEditor) content() string {
+	output := ""
+	for i, name := range this.newNames {
+		if this.deleted[i] {
+			name = this.options.Markers.deleteLine(this.oldNames[i])
+		}
+		output += name + newline()
+	}
+	return output
+}
+
+func (this *tuiEditor) modified() bool {
+	for i, name := range this.newNames {
+		if this.deleted[i] || name != this.oldNames[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs the same checks as fileActions() and records the lines that have a
+// problem, so that they can be highlighted.
+func (this *tuiEditor) check() {
+	// The warnings would be printed over the UI
+	logLevel := minLogLevel_
+	minLogLevel_ = 10
+	defer func() {
+		minLogLevel_ = logLevel
+	}()
+
+	this.conflicts = make(map[int]string)
+	this.problem = ""
+
+	actions, err := fileActionsWithOptions(this.filePaths, this.content(), this.options)
+	if err != nil {
+		this.problem = err.Error()
+		return
+	}
+
+	conflicts, err := fileActionConflicts(actions)
+	if err != nil {
+		this.problem = err.Error()
+		return
+	}
+
+	for _, conflict := range conflicts {
+		if _, ok := this.conflicts[conflict.action.line-1]; !ok {
+			this.conflicts[conflict.action.line-1] = conflict.message
+		}
+	}
+}
+
+func (this *tuiEditor) isSelected(index int) bool {
+	if this.selected[index] {
+		return true
+	}
+	if this.anchor < 0 {
+		return false
+	}
+	return (index >= this.anchor && index <= this.cursor) || (index <= this.anchor && index >= this.cursor)
+}
+
+// Returns the lines the commands apply to: the selected lines, or the
+// current line if there is no selection.
+func (this *tuiEditor) targets() []int {
+	var output []int
+	for i := range this.filePaths {
+		if this.isSelected(i) {
+			output = append(output, i)
+		}
+	}
+	if len(output) == 0 {
+		output = append(output, this.cursor)
+	}
+	return output
+}
+
+func (this *tuiEditor) clearSelection() {
+	this.selected = make([]bool, len(this.filePaths))
+	this.anchor = -1
+}
+
+func (this *tuiEditor) moveCursor(delta int) {
+	this.cursor += delta
+	if this.cursor >= len(this.filePaths) {
+		this.cursor = len(this.filePaths) - 1
+	}
+	if this.cursor < 0 {
+		this.cursor = 0
+	}
+}
+
+// Moves the cursor to the next line, or the previous one if direction is
+// -1, whose old or new name contains the search text.
+func (this *tuiEditor) findNext(direction int) {
+	if this.search == "" {
+		return
+	}
+
+	search := strings.ToLower(this.search)
+	count := len(this.filePaths)
+	for i := 1; i <= count; i++ {
+		index := ((this.cursor+i*direction)%count + count) % count
+		if strings.Contains(strings.ToLower(this.oldNames[index]), search) || strings.Contains(strings.ToLower(this.newNames[index]), search) {
+			this.cursor = index
+			this.message = ""
+			return
+		}
+	}
+
+	this.message = fmt.Sprintf("Not found: %s", this.search)
+}
+
+func isTextKey(key string) bool {
+	if utf8.RuneCountInString(key) != 1 {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(key)
+	return r >= 32 && r != 127
+}
+
+// Edits the input line of the edit and search modes.
+func (this *tuiEditor) handleInputKey(key string) {
+	switch {
+	case isTextKey(key):
+		r, _ := utf8.DecodeRuneInString(key)
+		this.input = append(this.input[:this.inputPos], append([]rune{r}, this.input[this.inputPos:]...)...)
+		this.inputPos++
+	case key == "backspace":
+		if this.inputPos > 0 {
+			this.input = append(this.input[:this.inputPos-1], this.input[this.inputPos:]...)
+			this.inputPos--
+		}
+	case key == "delete":
+		if this.inputPos < len(this.input) {
+			this.input = append(this.input[:this.inputPos], this.input[this.inputPos+1:]...)
+		}
+	case key == "left":
+		if this.inputPos > 0 {
+			this.inputPos--
+		}
+	case key == "right":
+		if this.inputPos < len(this.input) {
+			this.inputPos++
+		}
+	case key == "home" || key == "ctrl+a":
+		this.inputPos = 0
+	case key == "end" || key == "ctrl+e":
+		this.inputPos = len(this.input)
+	case key == "ctrl+u":
+		this.input = []rune{}
+		this.inputPos = 0
+	}
+}
+
+// Handles a key press. Returns done = true when the editor must be closed,
+// in which case apply tells whether the changes must be applied.
+func (this *tuiEditor) handleKey(key string) (done bool, apply bool) {
+	if len(this.filePaths) == 0 {
+		return true, false
+	}
+
+	switch this.mode {
+
+	case TUI_MODE_EDIT:
+
+		switch key {
+		case "enter":
+			this.newNames[this.cursor] = string(this.input)
+			this.deleted[this.cursor] = false
+			this.mode = TUI_MODE_NORMAL
+			this.check()
+		case "esc":
+			this.mode = TUI_MODE_NORMAL
+		default:
+			this.handleInputKey(key)
+		}
+		return false, false
+
+	case TUI_MODE_SEARCH:
+
+		switch key {
+		case "enter":
+			this.search = string(this.input)
+			this.mode = TUI_MODE_NORMAL
+			this.findNext(1)
+		case "esc":
+			this.mode = TUI_MODE_NORMAL
+		default:
+			this.handleInputKey(key)
+		}
+		return false, false
+
+	}
+
+	confirmQuit := this.confirmQuit
+	this.confirmQuit = false
+	this.message = ""
+
+	switch key {
+
+	case "up", "k":
+		this.moveCursor(-1)
+	case "down", "j":
+		this.moveCursor(1)
+	case "pgup":
+		this.moveCursor(-10)
+	case "pgdn":
+		this.moveCursor(10)
+	case "home", "g":
+		this.moveCursor(-len(this.filePaths))
+	case "end", "G":
+		this.moveCursor(len(this.filePaths))
+
+	case "enter", "e", "i":
+		this.mode = TUI_MODE_EDIT
+		this.input = []rune(this.newNames[this.cursor])
+		this.inputPos = len(this.input)
+
+	case " ":
+		this.selected[this.cursor] = !this.selected[this.cursor]
+		this.moveCursor(1)
+
+	case "v":
+		if this.anchor < 0 {
+			this.anchor = this.cursor
+		} else {
+			for _, index := range this.targets() {
+				this.selected[index] = true
+			}
+			this.anchor = -1
+		}
+
+	case "esc":
+		this.clearSelection()
+
+	case "d":
+		targets := this.targets()
+		deleted := false
+		for _, index := range targets {
+			if !this.deleted[index] {
+				deleted = true
+			}
+		}
+		for _, index := range targets {
+			this.deleted[index] = deleted
+		}
+		this.clearSelection()
+		this.check()
+
+	case "u":
+		for _, index := range this.targets() {
+			this.newNames[index] = this.oldNames[index]
+			this.deleted[index] = false
+		}
+		this.clearSelection()
+		this.check()
+
+	case "/":
+		this.mode = TUI_MODE_SEARCH
+		this.input = []rune{}
+		this.inputPos = 0
+
+	case "n":
+		this.findNext(1)
+	case "N":
+		this.findNext(-1)
+
+	case "ctrl+s":
+		this.check()
+		if this.problem != "" {
+			this.message = "Cannot apply the changes: " + this.problem
+		} else if len(this.conflicts) > 0 {
+			this.message = fmt.Sprintf("Cannot apply the changes: %d conflict(s). The lines are marked with \"!\".", len(this.conflicts))
+		} else {
+			return true, true
+		}
+
+	case "q", "ctrl+c":
+		if this.modified() && !confirmQuit {
+			this.message = "The changes will be lost. Press q again to cancel."
+			this.confirmQuit = true
+		} else {
+			return true, false
+		}
+
+	}
+
+	return false, false
+}
+
+// Truncates or pads the string to the given number of columns.
+func fitText(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) > width {
+		return string(runes[:width-1]) + "~"
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+func (this *tuiEditor) statusText() string {
+	switch {
+	case this.mode == TUI_MODE_SEARCH:
+		return "/" + string(this.input)
+	case this.message != "":
+		return this.message
+	case this.conflicts[this.cursor] != "":
+		return this.conflicts[this.cursor]
+	case this.problem != "":
+		return this.problem
+	}
+
+	renamed := 0
+	deleted := 0
+	for i, name := range this.newNames {
+		if this.deleted[i] {
+			deleted++
+		} else if name != this.oldNames[i] {
+			renamed++
+		}
+	}
+	return fmt.Sprintf("%d file(s), %d renamed, %d deleted", len(this.filePaths), renamed, deleted)
+}
+
+// Returns the escape sequences that draw the whole screen.
+func (this *tuiEditor) render(width int, height int) string {
+	listHeight := height - 3
+	if listHeight < 1 {
+		listHeight = 1
+	}
+
+	if this.cursor < this.top {
+		this.top = this.cursor
+	}
+	if this.cursor >= this.top+listHeight {
+		this.top = this.cursor - listHeight + 1
+	}
+
+	columnWidth := (width - 6) / 2
+	cursorRow := 0
+	cursorColumn := 0
+
+	output := "\x1b[H\x1b[?25l"
+	output += "\x1b[2K\x1b[7m" + fitText(" "+TUI_HELP, width) + "\x1b[0m\r\n"
+	output += "\x1b[2K\x1b[1m" + fitText("   "+fitText("Original name", columnWidth)+" | New name", width) + "\x1b[0m\r\n"
+
+	for row := 0; row < listHeight; row++ {
+		index := this.top + row
+		output += "\x1b[2K"
+		if index >= len(this.filePaths) {
+			output += "\r\n"
+			continue
+		}
+
+		gutter := []rune("   ")
+		if this.isSelected(index) {
+			gutter[0] = '*'
+		}
+		if this.conflicts[index] != "" {
+			gutter[1] = '!'
+		}
+
+		newName := this.newNames[index]
+		color := ""
+		switch {
+		case this.mode == TUI_MODE_EDIT && index == this.cursor:
+			offset := 0
+			if this.inputPos >= columnWidth {
+				offset = this.inputPos - columnWidth + 1
+			}
+			newName = string(this.input[offset:])
+			cursorRow = row + 3
+			cursorColumn = 3 + columnWidth + 3 + this.inputPos - offset + 1
+		case this.deleted[index]:
+			newName = "<deleted>"
+			color = "\x1b[31m"
+		case this.conflicts[index] != "":
+			color = "\x1b[1;31m"
+		case newName != this.oldNames[index]:
+			color = "\x1b[32m"
+		}
+
+		if index == this.cursor {
+			output += "\x1b[7m"
+		}
+		output += string(gutter) + fitText(this.oldNames[index], columnWidth) + " | " + color + fitText(newName, width-columnWidth-6) + "\x1b[0m\r\n"
+	}
+
+	status := this.statusText()
+	output += "\x1b[2K" + fitText(status, width)
+
+	if this.mode == TUI_MODE_SEARCH {
+		cursorRow = height
+		cursorColumn = 1 + this.inputPos + 1
+	}
+
+	if cursorRow > 0 {
+		output += fmt.Sprintf("\x1b[%d;%dH\x1b[?25h", cursorRow, cursorColumn)
+	}
+
+	return output
+}
+
+// Converts the bytes read from the terminal to key names, such as "up",
+// "ctrl+s" or "a".
+func parseTuiKeys(b []byte) []string {
+	var output []string
+
+	for i := 0; i < len(b); {
+		c := b[i]
+
+		if c == 27 {
+			if i+1 < len(b) && (b[i+1] == '[' || b[i+1] == 'O') {
+				j := i + 2
+				for j < len(b) && (b[j] < 0x40 || b[j] > 0x7e) {
+					j++
+				}
+				if j >= len(b) {
+					break
+				}
+				sequence := string(b[i+2 : j+1])
+				i = j + 1
+				switch sequence {
+				case "A":
+					output = append(output, "up")
+				case "B":
+					output = append(output, "down")
+				case "C":
+					output = append(output, "right")
+				case "D":
+					output = append(output, "left")
+				case "H", "1~", "7~":
+					output = append(output, "home")
+				case "F", "4~", "8~":
+					output = append(output, "end")
+				case "5~":
+					output = append(output, "pgup")
+				case "6~":
+					output = append(output, "pgdn")
+				case "3~":
+					output = append(output, "delete")
+				}
+				continue
+			}
+			output = append(output, "esc")
+			i++
+			continue
+		}
+
+		switch {
+		case c == 13 || c == 10:
+			output = append(output, "enter")
+		case c == 127 || c == 8:
+			output = append(output, "backspace")
+		case c == 9:
+			output = append(output, "tab")
+		case c < 32:
+			output = append(output, "ctrl+"+string(rune('a'+c-1)))
+		default:
+			r, size := utf8.DecodeRune(b[i:])
+			output = append(output, string(r))
+			i += size
+			continue
+		}
+		i++
+	}
+
+	return output
+}
+
+// Opens the built-in editor on the terminal. Returns the content of the file
+// buffer, and whether the changes must be applied.
+func runTuiEditor(filePaths []string, newNames []string, options FileActionOptions) (string, bool, error) {
+	terminal, err := openTerminal()
+	if err != nil {
+		return "", false, err
+	}
+	defer terminal.Close()
+
+	restore, err := makeTerminalRaw(terminal)
+	if err != nil {
+		return "", false, err
+	}
+	defer restore()
+
+	// Alternate screen, so that the previous content of the terminal is
+	// restored on exit.
+	terminal.WriteString("\x1b[?1049h")
+	defer terminal.WriteString("\x1b[?25h\x1b[?1049l")
+
+	editor := newTuiEditor(filePaths, newNames, options)
+	buffer := make([]byte, 256)
+
+	for {
+		width, height, err := terminalSize(terminal)
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+
+		_, err = terminal.WriteString(editor.render(width, height))
+		if err != nil {
+			return "", false, err
+		}
+
+		n, err := terminal.Read(buffer)
+		if err != nil {
+			return "", false, err
+		}
+
+		for _, key := range parseTuiKeys(buffer[:n]) {
+			done, apply := editor.handleKey(key)
+			if done {
+				return editor.content(), apply, nil
+			}
+		}
+	}
+}
+
+func isTerminalAvailable() bool {
+	terminal, err := openTerminal()
+	if err != nil {
+		return false
+	}
+	terminal.Close()
+	return true
+}
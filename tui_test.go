@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseTuiKeys(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"ab", "a,b"},
+		{"\x1b[A\x1b[B\x1bOC", "up,down,right"},
+		{"\x1b[5~\x1b[3~", "pgup,delete"},
+		{"\x1b", "esc"},
+		{"\r\x7f\x13\x03", "enter,backspace,ctrl+s,ctrl+c"},
+		{"é ", "é, "},
+	}
+
+	for _, testCase := range testCases {
+		actual := strings.Join(parseTuiKeys([]byte(testCase.input)), ",")
+		if actual != testCase.expected {
+			t.Errorf("%q: expected %s, got %s", testCase.input, testCase.expected, actual)
+		}
+	}
+}
+
+func tuiPressKeys(editor *tuiEditor, keys ...string) (bool, bool) {
+	for _, key := range keys {
+		done, apply := editor.handleKey(key)
+		if done {
+			return done, apply
+		}
+	}
+	return false, false
+}
+
+func Test_tuiEditor(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	newline_ = "\n"
+
+	var filePaths []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		filePaths = append(filePaths, filepath.Join(tempFolder(), name))
+		touch(filePaths[len(filePaths)-1])
+	}
+
+	editor := newTuiEditor(filePaths, []string{"a", "b", "c", "d"}, FileActionOptions{})
+
+	// Edit the first name, then delete the second and third ones using a
+	// range selection.
+	tuiPressKeys(editor, "enter", "backspace", "x", "y", "left", "z", "enter")
+	tuiPressKeys(editor, "down", "v", "down", "d")
+
+	expected := "xzy\n//b\n//c\nd\n"
+	if editor.content() != expected {
+		t.Errorf("Expected %q, got %q", expected, editor.content())
+	}
+
+	// Revert the deletion of "c"
+	tuiPressKeys(editor, "u")
+	if editor.content() != "xzy\n//b\nc\nd\n" {
+		t.Errorf("Unexpected content: %q", editor.content())
+	}
+
+	// Search
+	tuiPressKeys(editor, "/", "X", "Z", "enter")
+	if editor.cursor != 0 {
+		t.Errorf("Expected cursor on line 0, got %d", editor.cursor)
+	}
+
+	// "d" is renamed to the existing "c", which is a conflict
+	tuiPressKeys(editor, "G", "enter", "backspace", "c", "enter")
+	if editor.conflicts[3] == "" {
+		t.Error("Expected a conflict on the last line")
+	}
+
+	if !strings.Contains(editor.render(80, 24), "!") {
+		t.Error("Conflict is not highlighted")
+	}
+
+	done, _ := tuiPressKeys(editor, "ctrl+s")
+	if done {
+		t.Error("Changes with conflicts should not be applied")
+	}
+
+	// Once the conflict is fixed, the changes can be applied
+	done, apply := tuiPressKeys(editor, "u", "ctrl+s")
+	if !done || !apply {
+		t.Error("Changes should have been applied")
+	}
+
+	actions, err := fileActions(filePaths, editor.content())
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(actions) != 2 {
+		t.Errorf("Expected 2 actions, got %d", len(actions))
+	}
+
+	// Cancelling with changes requires a confirmation
+	done, _ = tuiPressKeys(editor, "q")
+	if done {
+		t.Error("Cancelling should require a confirmation")
+	}
+	done, apply = tuiPressKeys(editor, "q")
+	if !done || apply {
+		t.Error("Editor should have been cancelled")
+	}
+}
@@ -1,62 +1,222 @@
 package main
 
 import (
-	"github.com/nu7hatch/gouuid"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/nu7hatch/gouuid"
 )
 
-func handleUndoCommand(opts *CommandLineOptions, args []string) error {
-	filePaths, err := filePathsFromArgs(args, true)
-	if err != nil {
-		return err
+// Parses the value of the --since option. It can be a date ("2006-01-02"),
+// a date and time ("2006-01-02 15:04", "2006-01-02T15:04:05Z07:00"),
+// "today", "yesterday" or a duration such as "2h" or "30m", in which case
+// it is relative to the current time.
+func parseSinceTime(s string, now time.Time) (int64, error) {
+	s = strings.Trim(s, " \t")
+	if s == "" {
+		return 0, errors.New("empty time value")
 	}
 
-	for i, p := range filePaths {
-		filePaths[i] = normalizePath(p)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch s {
+	case "today":
+		return midnight.Unix(), nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1).Unix(), nil
 	}
 
-	items, err := latestHistoryItemsByDestinations(filePaths)
-	if err != nil {
-		return err
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return now.Add(-d).Unix(), nil
+	}
+
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02T15:04",
+		"2006-01-02",
 	}
 
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, s, now.Location())
+		if err == nil {
+			return t.Unix(), nil
+		}
+	}
+
+	return 0, errors.New(fmt.Sprintf("invalid time: \"%s\". Expected a date such as \"2006-01-02 15:04\", \"today\", \"yesterday\" or a duration such as \"2h\"", s))
+}
+
+// Groups the items by operation, keeping the order of the provided slice.
+// Items saved before operation IDs were recorded are grouped by timestamp
+// instead.
+func historyItemsByOperation(items []HistoryItem) [][]HistoryItem {
+	var output [][]HistoryItem
+	for i, item := range items {
+		if i == 0 || item.OperationId != items[i-1].OperationId || item.Timestamp != items[i-1].Timestamp {
+			output = append(output, []HistoryItem{})
+		}
+		output[len(output)-1] = append(output[len(output)-1], item)
+	}
+	return output
+}
+
+// Returns eg. "/path/to/new"  =>  "/path/to/old" or "/path/to/file"  =>  mode 0644
+func undoDescription(item HistoryItem) string {
+	switch item.Kind {
+	case KIND_TOUCH:
+		if t, err := time.Parse(time.RFC3339Nano, item.PreviousValue); err == nil {
+			return fmt.Sprintf("\"%s\"  =>  %s %s", item.Dest, ATTRIBUTE_MTIME, formatMtime(t))
+		}
+		return fmt.Sprintf("\"%s\"  =>  %s %s", item.Dest, ATTRIBUTE_MTIME, item.PreviousValue)
+	case KIND_CHMOD:
+		return fmt.Sprintf("\"%s\"  =>  %s %s", item.Dest, ATTRIBUTE_MODE, item.PreviousValue)
+	}
+	return fmt.Sprintf("\"%s\"  =>  \"%s\"", item.Dest, item.Source)
+}
+
+func undoHistoryItems(items []HistoryItem, dryRun bool) error {
 	var conflictItems []HistoryItem
+	var renameItems []HistoryItem
 
+	// The attributes are restored first, while the files still have the
+	// names they have been given by the operation.
 	for _, item := range items {
-		if opts.DryRun {
+		if item.Kind != KIND_TOUCH && item.Kind != KIND_CHMOD {
+			renameItems = append(renameItems, item)
+			continue
+		}
+
+		if dryRun {
+			logInfo("%s", undoDescription(item))
+			continue
+		}
+
+		logDebug("%s", undoDescription(item))
+		err := undoAttributeHistoryItem(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range renameItems {
+		if dryRun {
 			logInfo("\"%s\"  =>  \"%s\"", item.Dest, item.Source)
 		} else {
 			logDebug("\"%s\"  =>  \"%s\"", item.Dest, item.Source)
 
-			if _, err := os.Stat(item.Source); os.IsNotExist(err) {
-				err = os.Rename(item.Dest, item.Source)
-				if err != nil {
-					return err
-				}
-			} else {
+			err := moveFile(item.Dest, item.Source)
+			if errors.Is(err, os.ErrExist) {
 				u, _ := uuid.NewV4()
 				item.IntermediatePath = item.Source + "-" + u.String()
 				conflictItems = append(conflictItems, item)
+			} else if err != nil {
+				return err
 			}
 		}
 	}
 
-	// See conflict resolution in main::processFileActions()
+	// The items whose source is used by another file of the operation (eg.
+	// two names that have been swapped) are moved to an intermediate name
+	// first, then to their source, as for the cycles in renameSteps().
 
 	for _, item := range conflictItems {
-		err := os.Rename(item.Dest, item.IntermediatePath)
+		err := moveFile(item.Dest, item.IntermediatePath)
 		if err != nil {
 			return err
 		}
 	}
 
 	for _, item := range conflictItems {
-		err := os.Rename(item.IntermediatePath, item.Source)
+		err := renameNoReplace(item.IntermediatePath, item.Source)
 		if err != nil {
 			return err
 		}
 	}
 
+	return nil
+}
+
+func handleUndoSelectorCommand(opts *CommandLineOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.New("file paths cannot be combined with --under or --since")
+	}
+
+	var minTimestamp int64
+	if opts.Since != "" {
+		var err error
+		minTimestamp, err = parseSinceTime(opts.Since, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	items, err := historyItemsUnder(opts.Under, minTimestamp)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		logInfo("No operation to undo.")
+		return nil
+	}
+
+	groups := historyItemsByOperation(items)
+
+	if !opts.DryRun {
+		logInfo("Undoing %d operation(s):", len(groups))
+		for _, item := range items {
+			logInfo("%s", undoDescription(item))
+		}
+	}
+
+	// Undo the most recent operations first, so that a file that has been
+	// renamed several times goes back through each of its previous names.
+	for _, group := range groups {
+		err = undoHistoryItems(group, opts.DryRun)
+		if err != nil {
+			return err
+		}
+
+		if !opts.DryRun {
+			deleteHistoryItems(group)
+		}
+	}
+
+	return nil
+}
+
+func handleUndoCommand(opts *CommandLineOptions, args []string) error {
+	if opts.Under != "" || opts.Since != "" {
+		return handleUndoSelectorCommand(opts, args)
+	}
+
+	filePaths, err := filePathsFromArgs(args, true)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range filePaths {
+		filePaths[i] = normalizePath(p)
+	}
+
+	items, err := latestHistoryItemsByDestinations(filePaths)
+	if err != nil {
+		return err
+	}
+
+	err = undoHistoryItems(items, opts.DryRun)
+	if err != nil {
+		return err
+	}
+
 	deleteHistoryItems(items)
 
 	return nil
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func Test_handleUndoCommand_noArgs(t *testing.T) {
@@ -173,3 +174,149 @@ func Test_handleUndoCommand_withIntermediateRename(t *testing.T) {
 		t.Error("File 1 was not restored")
 	}
 }
+
+func Test_parseSinceTime(t *testing.T) {
+	now := time.Date(2015, 6, 10, 14, 30, 0, 0, time.Local)
+
+	type TestCase struct {
+		value    string
+		expected time.Time
+		hasError bool
+	}
+
+	testCases := []TestCase{
+		{"today", time.Date(2015, 6, 10, 0, 0, 0, 0, time.Local), false},
+		{"yesterday", time.Date(2015, 6, 9, 0, 0, 0, 0, time.Local), false},
+		{"2h", time.Date(2015, 6, 10, 12, 30, 0, 0, time.Local), false},
+		{"2015-06-01", time.Date(2015, 6, 1, 0, 0, 0, 0, time.Local), false},
+		{"2015-06-01 08:15", time.Date(2015, 6, 1, 8, 15, 0, 0, time.Local), false},
+		{"last week", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+
+	for _, testCase := range testCases {
+		r, err := parseSinceTime(testCase.value, now)
+		if (err != nil) != testCase.hasError {
+			t.Errorf("Error status did not match for \"%s\": %s", testCase.value, err)
+			continue
+		}
+		if !testCase.hasError && r != testCase.expected.Unix() {
+			t.Errorf("Expected %d, got %d for \"%s\"", testCase.expected.Unix(), r, testCase.value)
+		}
+	}
+}
+
+func Test_handleUndoCommand_under(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	dir := filepath.Join(tempFolder(), "photos")
+	os.Mkdir(dir, 0700)
+
+	p0 := filepath.Join(dir, "0")
+	p1 := filepath.Join(dir, "1")
+	p2 := filepath.Join(tempFolder(), "2")
+	filePutContent(p0, "0")
+	filePutContent(p1, "1")
+	touch(p2)
+
+	fileActions := []*FileAction{}
+
+	fileAction := NewFileAction()
+	fileAction.oldPath = p0
+	fileAction.newPath = "abcd"
+	fileActions = append(fileActions, fileAction)
+
+	fileAction = NewFileAction()
+	fileAction.oldPath = p2
+	fileAction.newPath = "efgh"
+	fileActions = append(fileActions, fileAction)
+
+	processFileActions(fileActions, false)
+
+	// Second operation: abcd => 1 and 1 => 0, which requires going through
+	// the history in the right order to be undone.
+	fileActions = []*FileAction{}
+
+	fileAction = NewFileAction()
+	fileAction.oldPath = filepath.Join(dir, "abcd")
+	fileAction.newPath = "1"
+	fileActions = append(fileActions, fileAction)
+
+	fileAction = NewFileAction()
+	fileAction.oldPath = p1
+	fileAction.newPath = "0"
+	fileActions = append(fileActions, fileAction)
+
+	processFileActions(fileActions, false)
+	profileDb_.Exec("UPDATE history SET timestamp = timestamp - 10 WHERE id <= 2")
+
+	opts := CommandLineOptions{
+		Under: dir,
+	}
+	err := handleUndoCommand(&opts, []string{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if fileGetContent(p0) != "0" || fileGetContent(p1) != "1" {
+		t.Error("Files were not restored")
+	}
+
+	if fileExists(filepath.Join(dir, "abcd")) {
+		t.Error("Intermediate name was not restored")
+	}
+
+	if !fileExists(filepath.Join(tempFolder(), "efgh")) {
+		t.Error("File outside of directory should not have been restored")
+	}
+
+	historyItems, _ := allHistoryItems()
+	if len(historyItems) != 1 {
+		t.Errorf("Expected 1 item, got %d", len(historyItems))
+	}
+
+	err = handleUndoCommand(&opts, []string{"abcd"})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func Test_handleUndoCommand_since(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	touch(filepath.Join(tempFolder(), "one"))
+	touch(filepath.Join(tempFolder(), "two"))
+
+	fileActions := []*FileAction{}
+
+	fileAction := NewFileAction()
+	fileAction.oldPath = filepath.Join(tempFolder(), "one")
+	fileAction.newPath = "123"
+	fileActions = append(fileActions, fileAction)
+
+	fileAction = NewFileAction()
+	fileAction.oldPath = filepath.Join(tempFolder(), "two")
+	fileAction.newPath = "456"
+	fileActions = append(fileActions, fileAction)
+
+	processFileActions(fileActions, false)
+	profileDb_.Exec("UPDATE history SET timestamp = ? WHERE id = 1", time.Now().Unix()-60*60*5)
+
+	opts := CommandLineOptions{
+		Since: "1h",
+	}
+	err := handleUndoCommand(&opts, []string{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !fileExists(filepath.Join(tempFolder(), "123")) {
+		t.Error("Old operation should not have been undone")
+	}
+
+	if !fileExists(filepath.Join(tempFolder(), "two")) {
+		t.Error("Recent operation should have been undone")
+	}
+}
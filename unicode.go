@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Returns the normalization form matching the name ("NFC" or "NFD"). The
+// second value is false if no normalization should be done.
+func unicodeNormalizationForm(name string) (norm.Form, bool, error) {
+	switch strings.ToUpper(name) {
+	case "", "NONE":
+		return norm.NFC, false, nil
+	case "NFC":
+		return norm.NFC, true, nil
+	case "NFD":
+		return norm.NFD, true, nil
+	}
+	return norm.NFC, false, errors.New(fmt.Sprintf("unknown Unicode normalization: \"%s\". Possible values: none, NFC, NFD", name))
+}
+
+// Tells whether the two strings are different but would be the same once
+// normalized, which means they look the same to the user.
+func differOnlyInNormalization(s1 string, s2 string) bool {
+	return s1 != s2 && norm.NFC.String(s1) == norm.NFC.String(s2)
+}
+
+// Applies the normalization to the new names and warns about the names that
+// only differ in normalization, since they are displayed the same way but
+// are different files (or the same file, depending on the file system).
+func normalizeFileActions(actions []*FileAction, normalization string) ([]*FileAction, error) {
+	form, doNormalize, err := unicodeNormalizationForm(normalization)
+	if err != nil {
+		return actions, err
+	}
+
+	var output []*FileAction
+	newNames := make(map[string]*FileAction)
+
+	for _, action := range actions {
+		if action.kind != KIND_RENAME {
+			output = append(output, action)
+			continue
+		}
+
+		if doNormalize {
+			action.newPath = form.String(action.newPath)
+			if action.newPath == filepath.Base(action.oldPath) {
+				continue
+			}
+		}
+
+		if differOnlyInNormalization(action.newPath, filepath.Base(action.oldPath)) {
+			logInfo("Warning: line %d: \"%s\" only differs from the original name in its Unicode normalization. Depending on the file system, the file might not be renamed.", action.line, action.newPath)
+		}
+
+		key := norm.NFC.String(action.FullNewPath())
+		if action2, ok := newNames[key]; ok && action2.FullNewPath() != action.FullNewPath() {
+			logInfo("Warning: lines %d and %d: \"%s\" and \"%s\" only differ in their Unicode normalization. Depending on the file system, they might be considered as the same name.", action2.line, action.line, action2.newPath, action.newPath)
+		}
+		newNames[key] = action
+
+		output = append(output, action)
+	}
+
+	return output, nil
+}
+
+// Renames the files to their normalized names, without opening the editor.
+func handleNormalizeUnicodeCommand(opts *CommandLineOptions, args []string) error {
+	form, doNormalize, err := unicodeNormalizationForm(opts.NormalizeUnicode)
+	if err != nil {
+		return err
+	}
+
+	if !doNormalize {
+		return errors.New("a normalization form must be specified. eg. --normalize-unicode NFC")
+	}
+
+	filePaths, err := filePathsFromArgsWithOptions(args, filePathOptionsFromConfig(opts))
+	if err != nil {
+		return err
+	}
+
+	content := ""
+	for _, filePath := range filePaths {
+		content += form.String(filepath.Base(filePath)) + newline()
+	}
+
+	actions, err := fileActions(filePaths, content)
+	if err != nil {
+		return err
+	}
+
+	if len(actions) == 0 {
+		logInfo("All the filenames are already normalized.")
+		return nil
+	}
+
+	if confirmationRequested(opts) {
+		apply, err := confirmFileActionsOnce(actions)
+		if err != nil || !apply {
+			return err
+		}
+	}
+
+	return processFileActions(actions, opts.DryRun)
+}
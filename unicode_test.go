@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	nfcCafe = "café"
+	nfdCafe = "café"
+)
+
+func Test_differOnlyInNormalization(t *testing.T) {
+	if !differOnlyInNormalization(nfcCafe, nfdCafe) {
+		t.Error("Strings should only differ in normalization")
+	}
+
+	if differOnlyInNormalization(nfcCafe, nfcCafe) || differOnlyInNormalization(nfcCafe, "cafe") {
+		t.Error("Strings should not only differ in normalization")
+	}
+}
+
+func Test_fileActionsWithOptions_unicodeNormalization(t *testing.T) {
+	newline_ = "\n"
+	minLogLevel_ = 10
+
+	paths := []string{"abcd", nfcCafe}
+	content := nfdCafe + ".txt\n" + nfdCafe + "\n"
+
+	actions, err := fileActionsWithOptions(paths, content, FileActionOptions{UnicodeNormalization: "NFC"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	// The second line is the same as the original name once normalized
+	if len(actions) != 1 || actions[0].newPath != nfcCafe+".txt" {
+		t.Errorf("New names have not been normalized: %v", actions)
+	}
+
+	actions, _ = fileActionsWithOptions(paths, content, FileActionOptions{UnicodeNormalization: "none"})
+	if len(actions) != 2 || actions[0].newPath != nfdCafe+".txt" {
+		t.Errorf("New names should not have been normalized: %v", actions)
+	}
+
+	_, err = fileActionsWithOptions(paths, content, FileActionOptions{UnicodeNormalization: "NFKC"})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func Test_handleNormalizeUnicodeCommand(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	p0 := filepath.Join(tempFolder(), nfdCafe)
+	p1 := filepath.Join(tempFolder(), "other")
+	filePutContent(p0, "0")
+	touch(p1)
+
+	opts := CommandLineOptions{
+		NormalizeUnicode: "NFC",
+	}
+	err := handleNormalizeUnicodeCommand(&opts, []string{p0, p1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if fileGetContent(filepath.Join(tempFolder(), nfcCafe)) != "0" {
+		t.Error("File has not been renamed to its normalized name")
+	}
+
+	items, _ := allHistoryItems()
+	if len(items) != 1 {
+		t.Errorf("Expected 1 history item, got %d", len(items))
+	}
+
+	opts.NormalizeUnicode = "none"
+	err = handleNormalizeUnicodeCommand(&opts, []string{p1})
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func Test_handleNormalizeUnicodeCommand_confirm(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	p0 := filepath.Join(tempFolder(), nfdCafe)
+	touch(p0)
+
+	config_.SetString("confirm", "1")
+	defer func() { confirmationInput_ = nil }()
+
+	opts := CommandLineOptions{
+		NormalizeUnicode: "NFC",
+	}
+
+	confirmationInput_ = bufio.NewReader(strings.NewReader("n\n"))
+	err := handleNormalizeUnicodeCommand(&opts, []string{p0})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !fileExists(p0) {
+		t.Error("File has been renamed without confirmation")
+	}
+
+	confirmationInput_ = bufio.NewReader(strings.NewReader("y\n"))
+	err = handleNormalizeUnicodeCommand(&opts, []string{p0})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	if !fileExists(filepath.Join(tempFolder(), nfcCafe)) {
+		t.Error("File has not been renamed to its normalized name")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Interval at which the file is checked when it cannot be watched for
+// events.
+const WATCH_POLL_INTERVAL = 500 * time.Millisecond
+
+// If the "editor_background" config key is set and the editor command returns
+// faster than this without any change, it is assumed that the editor runs in
+// the background (eg. a GUI editor started without its "wait" option), so the
+// file list keeps being watched until it is saved or Ctrl + C is pressed.
+const DETACHED_EDITOR_DELAY = 2 * time.Second
+
+// Tells whether the editor command, which returned after the given duration
+// without the file list being saved, has probably left the editor running in
+// the background. Otherwise the editor has been closed without saving.
+func editorRunsInBackground(duration time.Duration) bool {
+	return config_.BoolD("editor_background", false) && duration < DETACHED_EDITOR_DELAY
+}
+
+// State of a file, used to tell whether it has been saved with a different
+// content. The content hash is needed since two saves done within the same
+// second with the same size cannot be told apart by their size and mtime.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+func readFileState(filePath string) (fileState, error) {
+	var output fileState
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return output, err
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return output, err
+	}
+
+	output.size = stat.Size()
+	output.modTime = stat.ModTime()
+	output.hash = stringHash(string(content))
+	return output, nil
+}
+
+// Tells whether the content of the file is different from the initial
+// state. A file that does not exist is considered unchanged since editors
+// that save by writing a new file and renaming it over the old one may
+// briefly remove it.
+func fileHasChanged(filePath string, initial fileState) (bool, error) {
+	stat, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if stat.Size() != initial.size {
+		return true, nil
+	}
+
+	state, err := readFileState(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return state.hash != initial.hash, nil
+}
+
+// Waits for the content of the file to be changed by checking it at regular
+// intervals. Returns true if it has been changed, or false if stop has been
+// closed first.
+func pollFileChanges(filePath string, initial fileState, stop <-chan bool) (bool, error) {
+	ticker := time.NewTicker(WATCH_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		changed, err := fileHasChanged(filePath, initial)
+		if err != nil || changed {
+			return changed, err
+		}
+
+		select {
+		case <-stop:
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Waits for the content of the file to be changed. The directory of the file
+// is watched with inotify rather than the file itself, so that saves done by
+// writing a new file and renaming it over the old one are detected too. If
+// inotify is not available, the file is polled instead. Only completed
+// writes are reported, so that a file being written is not read half-way.
+// Returns true if the file has been changed, or false if stop has been
+// closed first.
+func watchFileChanges(filePath string, initial fileState, stop <-chan bool) (bool, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		logDebug("Cannot use inotify, falling back to polling: %s", err)
+		return pollFileChanges(filePath, initial, stop)
+	}
+
+	// The file is non-blocking so that closing it interrupts Read()
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	defer inotify.Close()
+
+	_, err = unix.InotifyAddWatch(fd, filepath.Dir(filePath), unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO)
+	if err != nil {
+		logDebug("Cannot watch \"%s\", falling back to polling: %s", filepath.Dir(filePath), err)
+		return pollFileChanges(filePath, initial, stop)
+	}
+
+	done := make(chan bool)
+	defer close(done)
+	stopped := make(chan bool, 1)
+
+	go func() {
+		select {
+		case <-stop:
+			stopped <- true
+			inotify.Close()
+		case <-done:
+		}
+	}()
+
+	// The file might have been changed before the watch was added
+	changed, err := fileHasChanged(filePath, initial)
+	if err != nil || changed {
+		return changed, err
+	}
+
+	buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		_, err := inotify.Read(buffer)
+		if err != nil {
+			select {
+			case <-stopped:
+				return false, nil
+			default:
+				return false, err
+			}
+		}
+
+		// The events are not parsed since the directory only contains
+		// temporary files and checking the file is cheap.
+		changed, err := fileHasChanged(filePath, initial)
+		if err != nil || changed {
+			return changed, err
+		}
+	}
+}
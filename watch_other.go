@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// Waits for the content of the file to be changed. Returns true if it has
+// been changed, or false if stop has been closed first.
+func watchFileChanges(filePath string, initial fileState, stop <-chan bool) (bool, error) {
+	return pollFileChanges(filePath, initial, stop)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type watchFunc func(string, fileState, <-chan bool) (bool, error)
+
+func testWatchFunc(t *testing.T, name string, watch watchFunc) {
+	filePath := filepath.Join(tempFolder(), "watchtest")
+
+	type TestCase struct {
+		description string
+		change      func()
+	}
+
+	testCases := []TestCase{
+		{"same size", func() {
+			ioutil.WriteFile(filePath, []byte("tested!"), 0700)
+		}},
+		{"rename-replace", func() {
+			tempPath := filePath + ".tmp"
+			ioutil.WriteFile(tempPath, []byte("replaced"), 0700)
+			os.Rename(tempPath, filePath)
+		}},
+	}
+
+	for _, testCase := range testCases {
+		ioutil.WriteFile(filePath, []byte("testing"), 0700)
+		initial, err := readFileState(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := make(chan bool, 1)
+		go func() {
+			changed, err := watch(filePath, initial, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			result <- changed
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		testCase.change()
+
+		select {
+		case changed := <-result:
+			if !changed {
+				t.Errorf("%s: %s: change not detected", name, testCase.description)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: %s: change not detected", name, testCase.description)
+		}
+	}
+
+	// Saving the same content is not a change, and closing the stop channel
+	// ends the watch.
+	ioutil.WriteFile(filePath, []byte("testing"), 0700)
+	initial, _ := readFileState(filePath)
+	stop := make(chan bool)
+	result := make(chan bool, 1)
+	go func() {
+		changed, _ := watch(filePath, initial, stop)
+		result <- changed
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	ioutil.WriteFile(filePath, []byte("testing"), 0700)
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+
+	select {
+	case changed := <-result:
+		if changed {
+			t.Errorf("%s: unexpected change", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: watch has not been stopped", name)
+	}
+}
+
+func Test_watchFileChanges(t *testing.T) {
+	setup(t)
+	defer teardown(t)
+
+	testWatchFunc(t, "watchFileChanges", watchFileChanges)
+	testWatchFunc(t, "pollFileChanges", pollFileChanges)
+}
+
+func Test_editListFile_detachedEditor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The editor command is a POSIX shell command")
+	}
+
+	setup(t)
+	defer teardown(t)
+
+	listFilePath := filepath.Join(tempFolder(), "list.txt")
+	ioutil.WriteFile(listFilePath, []byte("a\n"), 0700)
+
+	// The editor command returns immediately without saving, which by
+	// default means that the editor has been closed.
+	config_.SetString("editor", "true")
+
+	changed, err := editListFile(listFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if changed {
+		t.Error("Expected the file list not to be changed")
+	}
+
+	// Unless the editor runs in the background, in which case the file list
+	// is saved later on.
+	config_.SetString("editor_background", "1")
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		ioutil.WriteFile(listFilePath, []byte("b\n"), 0700)
+	}()
+
+	changed, err = editListFile(listFilePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !changed {
+		t.Error("Expected the file list to be changed")
+	}
+}
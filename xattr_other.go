@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package main
+
+func copyXattrs(oldPath string, newPath string) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+func xattrNotSupported(err error) bool {
+	return err == unix.ENOTSUP || err == unix.EOPNOTSUPP
+}
+
+func xattrNames(path string) ([]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size <= 0 {
+		return []string{}, err
+	}
+
+	buffer := make([]byte, size)
+	size, err = unix.Listxattr(path, buffer)
+	if err != nil {
+		return []string{}, err
+	}
+
+	var output []string
+	for _, name := range bytes.Split(buffer[:size], []byte{0}) {
+		if len(name) > 0 {
+			output = append(output, string(name))
+		}
+	}
+	return output, nil
+}
+
+// Copies the extended attributes of oldPath to newPath. Nothing is done if
+// one of the file systems does not support extended attributes.
+func copyXattrs(oldPath string, newPath string) error {
+	names, err := xattrNames(oldPath)
+	if err != nil {
+		if xattrNotSupported(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, name := range names {
+		size, err := unix.Getxattr(oldPath, name, nil)
+		if err != nil {
+			return err
+		}
+
+		value := make([]byte, size)
+		size, err = unix.Getxattr(oldPath, name, value)
+		if err != nil {
+			return err
+		}
+
+		err = unix.Setxattr(newPath, name, value[:size], 0)
+		if err != nil {
+			if xattrNotSupported(err) {
+				logDebug("Extended attribute \"%s\" of \"%s\" could not be copied: %s", name, oldPath, err)
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}